@@ -3,8 +3,12 @@ module tele
 go 1.25.3
 
 require (
+	github.com/pkg/sftp v1.13.9
 	golang.org/x/crypto v0.48.0
 	golang.org/x/term v0.40.0
 )
 
-require golang.org/x/sys v0.41.0 // indirect
+require (
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/sys v0.41.0 // indirect
+)
@@ -0,0 +1,268 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"tele/internal/config"
+)
+
+// Actions recorded in the log.
+const (
+	ActionDecrypt = "decrypt"
+	ActionChange  = "change"
+	// ActionMaster is a change to the master password, the vault key or
+	// the means of recovering them.
+	ActionMaster = "master"
+	// ActionTeam is a change to a team vault's members.
+	ActionTeam = "team"
+	// ActionCA is a use of the certificate authority's key.
+	ActionCA = "ca"
+)
+
+// Entry is one line of the audit log. Each entry carries the hash of the
+// one before it, so editing or removing an entry breaks the chain.
+type Entry struct {
+	Seq         int       `json:"seq"`
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	Command     string    `json:"command"`
+	Destination string    `json:"destination"`
+	UID         int       `json:"uid"`
+	TTY         string    `json:"tty,omitempty"`
+	Host        string    `json:"host,omitempty"`
+	From        string    `json:"from,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	Prev        string    `json:"prev"`
+	Hash        string    `json:"hash"`
+}
+
+// head is the last entry's sequence number and hash, kept apart from the
+// log so that cutting entries off its end is noticed.
+type head struct {
+	Seq  int    `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// hash computes an entry's hash over its content and the previous hash.
+func (e Entry) hash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func paths() (log, headPath string, err error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(dir, "audit.log"), filepath.Join(dir, "audit.head"), nil
+}
+
+// Record appends an entry for the current user and terminal. detail, if
+// not empty, says what happened where the action alone does not.
+func Record(action, command, destination, detail string) error {
+	host, _ := os.Hostname()
+	e := Entry{
+		Time:        time.Now().UTC(),
+		Action:      action,
+		Command:     command,
+		Destination: destination,
+		UID:         os.Getuid(),
+		TTY:         ttyName(),
+		Host:        host,
+		Detail:      detail,
+	}
+	// Over SSH, where the user came from.
+	if client := strings.Fields(os.Getenv("SSH_CLIENT")); len(client) > 0 {
+		e.From = client[0]
+	}
+	return appendEntry(e)
+}
+
+func appendEntry(e Entry) error {
+	logPath, headPath, err := paths()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Concurrent tele processes must not both chain onto the same entry.
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	last, err := lastEntry(f)
+	if err != nil {
+		return err
+	}
+	e.Seq = last.Seq + 1
+	e.Prev = last.Hash
+	e.Hash = e.hash()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(head{Seq: e.Seq, Hash: e.Hash})
+	if err != nil {
+		return err
+	}
+	// The new head is written before the entry and renamed into place
+	// after it, so only a failed rename leaves it behind the log.
+	tmp := headPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, headPath)
+}
+
+// lastEntry reads the final entry of the log, or a zero entry if it is
+// empty.
+func lastEntry(f *os.File) (Entry, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return Entry{}, err
+	}
+	const tail = 64 * 1024
+	offset := max(info.Size()-tail, 0)
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return Entry{}, err
+	}
+	buf = bytes.TrimRight(buf, "\n")
+	if len(buf) == 0 {
+		return Entry{}, nil
+	}
+	line := buf[bytes.LastIndexByte(buf, '\n')+1:]
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return Entry{}, fmt.Errorf("audit log: last entry is damaged: %w", err)
+	}
+	return e, nil
+}
+
+// Load reads every entry of the log.
+func Load() ([]Entry, error) {
+	logPath, _, err := paths()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(logPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return entries, &BrokenError{Seq: n, Reason: "does not parse"}
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// BrokenError reports where the log's chain is broken.
+type BrokenError struct {
+	Seq    int
+	Reason string
+}
+
+func (e *BrokenError) Error() string {
+	return fmt.Sprintf("entry %d %s", e.Seq, e.Reason)
+}
+
+// ErrHeadBehind reports an intact log whose head was not updated for its
+// last entry, as a failed write of the head leaves it. The next entry
+// brings it up to date.
+var ErrHeadBehind = errors.New("audit.head was not updated for the last entry")
+
+// Verify checks the whole chain, and that the log ends where the head says
+// it does. It returns the number of entries checked.
+//
+// The chain is not keyed: it catches entries edited, removed or cut off by
+// hand, but someone who can write to tele's directory can rewrite the
+// whole log and its head.
+func Verify() (int, error) {
+	entries, err := Load()
+	if err != nil {
+		return len(entries), err
+	}
+	prev := ""
+	for i, e := range entries {
+		switch {
+		case e.Seq != i+1:
+			return i, &BrokenError{Seq: i + 1, Reason: fmt.Sprintf("is numbered %d; entries were removed or reordered", e.Seq)}
+		case e.Prev != prev:
+			return i, &BrokenError{Seq: e.Seq, Reason: "does not follow the entry before it; entries were removed or edited"}
+		case e.hash() != e.Hash:
+			return i, &BrokenError{Seq: e.Seq, Reason: "was edited"}
+		}
+		prev = e.Hash
+	}
+
+	_, headPath, err := paths()
+	if err != nil {
+		return len(entries), err
+	}
+	var h head
+	data, err := os.ReadFile(headPath)
+	switch {
+	case os.IsNotExist(err):
+		// As for a log whose first entry has not been written.
+	case err != nil:
+		return len(entries), err
+	default:
+		if err := json.Unmarshal(data, &h); err != nil {
+			return len(entries), fmt.Errorf("audit.head: %w", err)
+		}
+	}
+	switch {
+	case h.Seq == len(entries) && h.Hash == prev:
+		return len(entries), nil
+	case h.Seq == len(entries)-1 && h.Hash == entries[len(entries)-1].Prev:
+		return len(entries), ErrHeadBehind
+	case os.IsNotExist(err):
+		return len(entries), fmt.Errorf("audit.head is missing")
+	}
+	return len(entries), fmt.Errorf("the log ends at entry %d but %d were written; it was truncated or replaced", len(entries), h.Seq)
+}
+
+// ttyName returns the terminal on standard input, if any.
+func ttyName() string {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return ""
+	}
+	if name, err := os.Readlink("/proc/self/fd/0"); err == nil {
+		return name
+	}
+	return "tty"
+}
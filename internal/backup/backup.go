@@ -0,0 +1,205 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tele/internal/crypto"
+)
+
+// Format identifies a tele backup file, and Version its layout. Open
+// refuses versions it does not know.
+const (
+	Format  = "tele-backup"
+	Version = 1
+)
+
+// topFiles are the files a backup holds from the top of the tele directory.
+// It leaves out the auto-installed sshpass, connection sockets, files
+// regenerated from the destinations (ssh_config, known_hosts), the sync
+// history and this machine's audit log, since restoring it would rewind
+// it.
+var topFiles = map[string]bool{
+	"master.json":     true,
+	"ca.json":         true,
+	"identity.json":   true,
+	"settings.json":   true,
+	"health.json":     true,
+	"totp_steps.json": true,
+}
+
+// inLayout reports whether name, a slash-separated path in the tele
+// directory, is a file a backup holds: one of topFiles, a destination, the
+// team file, or a recording. Open refuses anything else, such as bin/sshpass
+// or the sync repository's git config, which a crafted archive could
+// otherwise replace.
+func inLayout(name string) bool {
+	dir, file := path.Split(name)
+	switch dir {
+	case "":
+		return topFiles[file]
+	case "destinations/":
+		// .master.json is the sync copy of master.json.
+		return file == ".team.json" || (strings.HasSuffix(file, ".json") && !strings.HasPrefix(file, "."))
+	case "recordings/":
+		return file != "" && !strings.HasPrefix(file, ".")
+	}
+	return false
+}
+
+// ErrPassphrase is returned by Open when the passphrase is wrong or the
+// file was tampered with; AES-GCM cannot tell the two apart.
+var ErrPassphrase = errors.New("wrong backup passphrase, or the backup is corrupt")
+
+// Archive is the content of a backup: files of the tele directory keyed by
+// slash-separated path relative to it.
+type Archive struct {
+	Version int               `json:"version"`
+	Created time.Time         `json:"created"`
+	Files   map[string][]byte `json:"files"`
+}
+
+// envelope is the backup file itself. Only the archive is secret; the
+// header is repeated inside it, so tampering with it is detected.
+type envelope struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	Created    time.Time `json:"created"`
+	KDF        kdf       `json:"kdf"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// kdf records how the key was derived from the passphrase.
+type kdf struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// Collect reads the tele directory into an archive.
+func Collect(dir string, recordings bool) (*Archive, error) {
+	a := &Archive{Version: Version, Created: time.Now().UTC(), Files: map[string][]byte{}}
+	err := filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if e.IsDir() {
+			if rel == "." || rel == "destinations" || (rel == "recordings" && recordings) {
+				return nil
+			}
+			return filepath.SkipDir
+		}
+		if !e.Type().IsRegular() || !inLayout(rel) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		a.Files[rel] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Seal encrypts an archive under a key derived from passphrase.
+func Seal(a *Archive, passphrase string) ([]byte, error) {
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	if err := json.NewEncoder(zw).Encode(a); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+	ct, nonce, err := crypto.Encrypt(plain.Bytes(), crypto.DeriveKey(passphrase, salt))
+	if err != nil {
+		return nil, err
+	}
+	env := envelope{
+		Format:  Format,
+		Version: a.Version,
+		Created: a.Created,
+		KDF: kdf{
+			Name:    "argon2id",
+			Salt:    salt,
+			Time:    crypto.ArgonTime,
+			Memory:  crypto.ArgonMem,
+			Threads: crypto.ArgonThreads,
+		},
+		Nonce:      nonce,
+		Ciphertext: ct,
+	}
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// Open decrypts and validates a backup file.
+func Open(data []byte, passphrase string) (*Archive, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Format != Format {
+		return nil, fmt.Errorf("not a tele backup")
+	}
+	if env.Version != Version {
+		return nil, fmt.Errorf("backup version %d is not supported by this tele (version %d)", env.Version, Version)
+	}
+	if env.KDF.Name != "argon2id" || env.KDF.Time != crypto.ArgonTime ||
+		env.KDF.Memory != crypto.ArgonMem || env.KDF.Threads != crypto.ArgonThreads {
+		return nil, fmt.Errorf("backup uses unsupported key derivation %s(t=%d, m=%d, p=%d)",
+			env.KDF.Name, env.KDF.Time, env.KDF.Memory, env.KDF.Threads)
+	}
+
+	plain, err := crypto.Decrypt(env.Ciphertext, env.Nonce, crypto.DeriveKey(passphrase, env.KDF.Salt))
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+	var a Archive
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+	if a.Version != env.Version || !a.Created.Equal(env.Created) {
+		return nil, fmt.Errorf("backup header does not match its contents")
+	}
+	for name := range a.Files {
+		if !inLayout(name) {
+			return nil, fmt.Errorf("backup contains unexpected file %q", name)
+		}
+	}
+	if _, ok := a.Files["master.json"]; !ok {
+		return nil, fmt.Errorf("backup has no master.json")
+	}
+	return &a, nil
+}
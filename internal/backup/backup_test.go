@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"master.json", "master.json.tmp", "ca.json", "settings.json", "audit.log", "audit.head",
+		"ssh_config", "known_hosts", "bin/sshpass", "mux/prod.sock",
+		"destinations/prod.json", "destinations/.team.json", "destinations/.master.json",
+		"destinations/.git/config", "destinations/.git/hooks/post-merge",
+		"recordings/prod-1.cast",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		recordings bool
+		want       []string
+	}{
+		{false, []string{"ca.json", "destinations/.team.json", "destinations/prod.json", "master.json", "settings.json"}},
+		{true, []string{"ca.json", "destinations/.team.json", "destinations/prod.json", "master.json", "recordings/prod-1.cast", "settings.json"}},
+	} {
+		a, err := Collect(dir, tc.recordings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for name := range a.Files {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Collect(recordings %v) = %q, want %q", tc.recordings, got, tc.want)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	seal := func(files map[string][]byte) []byte {
+		t.Helper()
+		a := &Archive{Version: Version, Files: files}
+		data, err := Seal(a, "passphrase")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	data := seal(map[string][]byte{"master.json": []byte("{}"), "destinations/prod.json": []byte("{}")})
+	if _, err := Open(data, "wrong"); err != ErrPassphrase {
+		t.Errorf("wrong passphrase: err = %v", err)
+	}
+	a, err := Open(data, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a.Files["destinations/prod.json"]) != "{}" {
+		t.Errorf("Open lost a destination: %q", a.Files)
+	}
+
+	// Files Collect never archives mark a crafted backup.
+	for _, name := range []string{
+		"bin/sshpass",
+		"mux/prod.sock",
+		"ssh_config",
+		"audit.log",
+		"destinations/.git/config",
+		"destinations/.git/hooks/post-merge",
+		"destinations/.master.json",
+		"destinations/sub/prod.json",
+		"recordings/../bin/sshpass",
+		"../master.json",
+		"/etc/passwd",
+	} {
+		data := seal(map[string][]byte{"master.json": []byte("{}"), name: []byte("x")})
+		if _, err := Open(data, "passphrase"); err == nil || !strings.Contains(err.Error(), "unexpected file") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
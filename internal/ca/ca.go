@@ -0,0 +1,117 @@
+package ca
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// clockSkew backdates certificates so servers with a slightly slow clock
+// accept them straight away.
+const clockSkew = time.Minute
+
+// defaultExtensions are the permissions ssh-keygen grants by default.
+var defaultExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// Issued is a user certificate together with its private key.
+type Issued struct {
+	Cert *ssh.Certificate
+	Key  ed25519.PrivateKey
+}
+
+// Signer returns a signer that authenticates with the certificate.
+func (is *Issued) Signer() (ssh.Signer, error) {
+	key, err := ssh.NewSignerFromKey(is.Key)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewCertSigner(is.Cert, key)
+}
+
+// MarshalKey encodes the private key in OpenSSH PEM format.
+func (is *Issued) MarshalKey(comment string) ([]byte, error) {
+	block, err := ssh.MarshalPrivateKey(is.Key, comment)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// ParseIssued reverses MarshalKey and ssh.MarshalAuthorizedKey of the
+// certificate.
+func ParseIssued(keyPEM, cert []byte) (*Issued, error) {
+	raw, err := ssh.ParseRawPrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := raw.(*ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate key is %T, not ed25519", raw)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(cert)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("not a certificate")
+	}
+	return &Issued{Cert: c, Key: *key}, nil
+}
+
+// GenerateKey creates a new ed25519 key pair, for a CA or a user.
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// Sign issues a user certificate for pub, valid for the given principals
+// from now until validity has passed.
+func Sign(ca ssh.Signer, pub ssh.PublicKey, keyID string, principals []string, validity time.Duration) (*ssh.Certificate, error) {
+	serial := make([]byte, 8)
+	if _, err := rand.Read(serial); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          binary.BigEndian.Uint64(serial),
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-clockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(validity).Unix()),
+		Permissions:     ssh.Permissions{Extensions: defaultExtensions},
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// Issue generates a fresh key pair and signs a certificate for it.
+func Issue(ca ssh.Signer, keyID string, principals []string, validity time.Duration) (*Issued, error) {
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := Sign(ca, sshPub, keyID, principals, validity)
+	if err != nil {
+		return nil, err
+	}
+	return &Issued{Cert: cert, Key: priv}, nil
+}
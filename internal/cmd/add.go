@@ -1,14 +1,24 @@
 package cmd
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
-	"tele/internal/crypto"
 	"tele/internal/store"
 )
 
-func RunAdd(name string) {
+func RunAdd(args []string) {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	generate := fs.Bool("generate", false, "generate the destination password instead of prompting for it")
+	genOpts := addGenFlags(fs)
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele add [--generate [generator options]] <name>")
+		os.Exit(1)
+	}
+	name := positional[0]
+
 	exists, err := store.MasterExists()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -57,31 +67,53 @@ func RunAdd(name string) {
 		os.Exit(1)
 	}
 
-	fmt.Print("Password: ")
-	destPass, err := readPassword()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "\nError reading password: %v\n", err)
+	d := &store.Destination{
+		Host: host,
+		Port: port,
+		User: user,
+	}
+	if err := promptAuth(d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Println()
 
-	salt, err := crypto.GenerateSalt()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating salt: %v\n", err)
-		os.Exit(1)
+	var destPass string
+	switch {
+	case d.Auth != store.AuthPassword:
+	case *generate:
+		destPass = generatePassword(genOpts)
+		fmt.Printf("Password: %s\n", destPass)
+	default:
+		fmt.Print("Password: ")
+		destPass, err = readPassword()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError reading password: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println()
 	}
 
-	key := crypto.DeriveKey(masterPass, salt)
-	encPass, nonce, err := crypto.Encrypt([]byte(destPass), key)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error encrypting password: %v\n", err)
+	if err := promptTOTP(masterPass, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if err := promptSettings(d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if d.Auth == store.AuthPassword {
+		if err := encryptPassword(masterPass, []byte(destPass), d); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encrypting password: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	if err := store.WriteDestination(name, host, port, user, encPass, nonce, salt); err != nil {
+	if err := store.SaveDestination(name, d); err != nil {
 		fmt.Fprintf(os.Stderr, "Error saving destination: %v\n", err)
 		os.Exit(1)
 	}
+	auditChange(name)
+	destinationsChanged("Add " + name)
 
 	fmt.Printf("Destination %q added.\n", name)
 }
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"tele/internal/audit"
+)
+
+func RunAudit(args []string) {
+	if len(args) > 0 && args[0] == "verify" {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: tele audit verify")
+			os.Exit(1)
+		}
+		runAuditVerify()
+		return
+	}
+
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	dest := fs.String("dest", "", "only entries for this destination")
+	command := fs.String("command", "", "only entries made by this command (go, exec, add, ...)")
+	action := fs.String("action", "", "only entries of this kind (decrypt|change|master|team|ca)")
+	since := fs.Duration("since", 0, "only entries this recent (e.g. 24h)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: tele audit [--dest <name>] [--command <cmd>] [--action decrypt|change|master|team|ca] [--since <duration>] | verify")
+		os.Exit(1)
+	}
+
+	entries, err := audit.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading audit log: %v\n", err)
+		os.Exit(1)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tACTION\tCOMMAND\tDESTINATION\tUID\tTTY\tFROM\tDETAIL")
+	shown := 0
+	for _, e := range entries {
+		if (*dest != "" && e.Destination != *dest) || (*command != "" && e.Command != *command) ||
+			(*action != "" && e.Action != *action) || (*since > 0 && time.Since(e.Time) > *since) {
+			continue
+		}
+		from := e.Host
+		if e.From != "" {
+			from = e.From + " → " + e.Host
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", e.Time.Local().Format("2006-01-02 15:04:05"),
+			e.Action, e.Command, orDash(e.Destination), e.UID, orDash(e.TTY), orDash(from), e.Detail)
+		shown++
+	}
+	if shown == 0 {
+		fmt.Println("No audit entries match.")
+		return
+	}
+	tw.Flush()
+}
+
+func runAuditVerify() {
+	n, err := audit.Verify()
+	switch {
+	case errors.Is(err, audit.ErrHeadBehind):
+		fmt.Printf("The audit log is intact (%d entries), but audit.head was not updated for the last one,\n", n)
+		fmt.Println("as happens when writing it fails. The next entry brings it up to date.")
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "The audit log has been tampered with: %v.\n", err)
+		if n > 0 {
+			fmt.Fprintf(os.Stderr, "Entries 1 to %d are intact.\n", n)
+		}
+		os.Exit(1)
+	default:
+		fmt.Printf("The audit log is intact (%d entries).\n", n)
+	}
+	fmt.Println("The chain is not keyed: someone who can write to tele's directory could rewrite the whole log and audit.head.")
+}
+
+// auditDecrypt records that the running command decrypted a destination's
+// credentials.
+func auditDecrypt(name string) {
+	auditRecord(audit.ActionDecrypt, name, "")
+}
+
+// auditChange records that the running command changed a destination.
+func auditChange(name string) {
+	auditRecord(audit.ActionChange, name, "")
+}
+
+// auditMaster records a change to the master password, the vault key or
+// the means of recovering them.
+func auditMaster(detail string) {
+	auditRecord(audit.ActionMaster, "", detail)
+}
+
+// auditTeam records a change to the team vault's members.
+func auditTeam(detail string) {
+	auditRecord(audit.ActionTeam, "", detail)
+}
+
+// auditCA records that the running command decrypted the certificate
+// authority's key.
+func auditCA() {
+	auditRecord(audit.ActionCA, "", "")
+}
+
+func auditRecord(action, name, detail string) {
+	if err := audit.Record(action, os.Args[1], name, detail); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not write the audit log: %v\n", err)
+	}
+}
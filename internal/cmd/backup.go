@@ -0,0 +1,422 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tele/internal/backup"
+	"tele/internal/config"
+	"tele/internal/crypto"
+	"tele/internal/mux"
+	"tele/internal/store"
+)
+
+func RunBackup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	recordings := fs.Bool("recordings", false, "include session recordings")
+	force := fs.Bool("force", false, "overwrite an existing file")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele backup [--recordings] [--force] <file>")
+		os.Exit(1)
+	}
+	path := positional[0]
+
+	requireInit()
+	if _, err := os.Stat(path); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "%s already exists; use --force to overwrite it.\n", path)
+		os.Exit(1)
+	}
+
+	masterPass, _ := readMasterPassword()
+
+	fmt.Println("The backup is encrypted with its own passphrase, which you will need to restore it.")
+	fmt.Print("Backup passphrase: ")
+	passphrase, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError reading passphrase: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	if passphrase == "" {
+		fmt.Fprintln(os.Stderr, "Passphrase cannot be empty.")
+		os.Exit(1)
+	}
+	if passphrase == masterPass {
+		fmt.Fprintln(os.Stderr, "Use a passphrase other than the master password.")
+		os.Exit(1)
+	}
+	fmt.Print("Confirm backup passphrase: ")
+	confirm, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError reading passphrase: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	if passphrase != confirm {
+		fmt.Fprintln(os.Stderr, "Passphrases do not match.")
+		os.Exit(1)
+	}
+
+	dir, err := config.Dir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	archive, err := backup.Collect(dir, *recordings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading vault: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := backup.Seal(archive, passphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encrypting backup: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing backup: %v\n", err)
+		os.Exit(1)
+	}
+
+	dests := 0
+	for name := range archive.Files {
+		if strings.HasPrefix(name, "destinations/") {
+			dests++
+		}
+	}
+	fmt.Printf("Backed up %d destination(s) and %d other file(s) to %s.\n", dests, len(archive.Files)-dests, path)
+}
+
+// Outcomes of restoring one file, as reported.
+const (
+	restoreAdded     = "added"
+	restoreReplaced  = "replaced"
+	restoreRemoved   = "removed"
+	restoreUnchanged = "unchanged"
+	restoreConflict  = "conflict"
+)
+
+// restoreItem is what restoring does to one file of the vault.
+type restoreItem struct {
+	path    string
+	outcome string
+	data    []byte
+}
+
+func RunRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	mode := fs.String("mode", "merge", "merge: add what is missing and keep local versions of conflicting files; overwrite: replace the vault with the backup")
+	dryRun := fs.Bool("dry-run", false, "validate the backup and report what would change without changing anything")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 || (*mode != "merge" && *mode != "overwrite") {
+		fmt.Fprintln(os.Stderr, "Usage: tele restore [--mode merge|overwrite] [--dry-run] <file>")
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print("Backup passphrase: ")
+	passphrase, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError reading passphrase: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	archive, err := backup.Open(data, passphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	backupMaster, err := validateArchive(archive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid backup: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Backup from %s is valid.\n", archive.Created.Local().Format("2006-01-02 15:04"))
+
+	dir, err := config.Dir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	exists, err := store.MasterExists()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var items []restoreItem
+	if exists && *mode == "merge" {
+		items, err = planMerge(dir, archive, backupMaster, *dryRun)
+	} else {
+		items, err = planOverwrite(dir, archive)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	counts := map[string]int{}
+	for _, it := range items {
+		counts[it.outcome]++
+		note := ""
+		if it.outcome == restoreConflict {
+			note = " (differs from the backup; kept the local one)"
+		}
+		if it.outcome != restoreUnchanged {
+			fmt.Printf("  %-9s  %s%s\n", it.outcome, it.path, note)
+		}
+	}
+	var summary []string
+	for _, o := range []string{restoreAdded, restoreReplaced, restoreRemoved, restoreUnchanged, restoreConflict} {
+		if counts[o] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[o], o))
+		}
+	}
+	if len(summary) == 0 {
+		summary = append(summary, "nothing to restore")
+	}
+	fmt.Println(strings.Join(summary, ", ") + ".")
+
+	if *dryRun {
+		fmt.Println("Dry run; nothing was changed.")
+		return
+	}
+	if exists && *mode == "overwrite" {
+		ok, err := promptYesNo("Replace the local vault, including its master password, with the backup?", false)
+		if err != nil || !ok {
+			fmt.Println("Nothing was changed.")
+			return
+		}
+	}
+
+	for _, it := range items {
+		full := filepath.Join(dir, filepath.FromSlash(it.path))
+		switch it.outcome {
+		case restoreAdded, restoreReplaced:
+			if err := os.MkdirAll(filepath.Dir(full), 0700); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := writeFileAtomic(full, it.data); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", it.path, err)
+				os.Exit(1)
+			}
+		case restoreRemoved:
+			if err := os.Remove(full); err != nil {
+				fmt.Fprintf(os.Stderr, "Error removing %s: %v\n", it.path, err)
+				os.Exit(1)
+			}
+		default:
+			continue
+		}
+		if name, ok := destinationFile(it.path); ok {
+			// A shared connection would keep using the old settings.
+			mux.Stop(name)
+			auditChange(name)
+		} else if it.path == "master.json" {
+			auditMaster("master password replaced from a backup")
+		}
+	}
+	destinationsChanged("Restore backup")
+	fmt.Println("Restore complete.")
+}
+
+// validateArchive checks that the backup's vault files parse, and returns
+// its master config.
+func validateArchive(a *backup.Archive) (*store.MasterConfig, error) {
+	var master store.MasterConfig
+	if err := json.Unmarshal(a.Files["master.json"], &master); err != nil {
+		return nil, fmt.Errorf("master.json: %w", err)
+	}
+	for path, data := range a.Files {
+		if _, ok := destinationFile(path); ok {
+			var d store.Destination
+			if err := json.Unmarshal(data, &d); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	if data, ok := a.Files["ca.json"]; ok {
+		var authority store.CA
+		if err := json.Unmarshal(data, &authority); err != nil {
+			return nil, fmt.Errorf("ca.json: %w", err)
+		}
+	}
+	return &master, nil
+}
+
+// destinationFile returns the destination name a vault path holds.
+func destinationFile(path string) (string, bool) {
+	name, ok := strings.CutPrefix(path, "destinations/")
+	if !ok || strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	return strings.CutSuffix(name, ".json")
+}
+
+// planOverwrite replaces the vault with the backup: every file in it is
+// written, and local files it does not have are removed, except those a
+// backup never contains.
+func planOverwrite(dir string, a *backup.Archive) ([]restoreItem, error) {
+	local, err := backup.Collect(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	var items []restoreItem
+	for _, path := range sortedPaths(a.Files) {
+		it := restoreItem{path: path, data: a.Files[path], outcome: restoreAdded}
+		if cur, ok := local.Files[path]; ok {
+			it.outcome = restoreReplaced
+			if bytes.Equal(cur, it.data) {
+				it.outcome = restoreUnchanged
+			}
+		}
+		items = append(items, it)
+	}
+	for _, path := range sortedPaths(local.Files) {
+		if _, ok := a.Files[path]; ok {
+			continue
+		}
+		// Recordings are only in backups made with --recordings.
+		if strings.HasPrefix(path, "recordings/") {
+			continue
+		}
+		items = append(items, restoreItem{path: path, outcome: restoreRemoved})
+	}
+	return items, nil
+}
+
+// planMerge adds what the local vault lacks and keeps local versions of
+// files that differ. If the backup was made under another master password,
+// the secrets it adds are re-encrypted under the local one.
+func planMerge(dir string, a *backup.Archive, backupMaster *store.MasterConfig, dryRun bool) ([]restoreItem, error) {
+	local, err := backup.Collect(dir, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var reencrypt func(path string, data []byte) ([]byte, error)
+	if !sameVault(local.Files["master.json"], a.Files["master.json"]) && !dryRun {
+		fmt.Println("The backup was made under a different master password.")
+		fmt.Print("Master password of the backup: ")
+		oldPass, err := readPassword()
+		fmt.Println()
+		if err != nil {
+			return nil, err
+		}
+		salt, hash, err := decodeMaster(backupMaster)
+		if err != nil {
+			return nil, err
+		}
+		if !crypto.VerifyPassword(oldPass, salt, hash) {
+			return nil, fmt.Errorf("incorrect master password for the backup")
+		}
+		if oldPass, err = vaultSecret(oldPass, backupMaster); err != nil {
+			return nil, fmt.Errorf("unlocking the backup's vault key: %w", err)
+		}
+		fmt.Println("Now the local vault's.")
+		newPass := verifyMasterPassword()
+		reencrypt = func(path string, data []byte) ([]byte, error) {
+			return reencryptFile(path, data, oldPass, newPass)
+		}
+	}
+
+	var items []restoreItem
+	for _, path := range sortedPaths(a.Files) {
+		if path == "master.json" {
+			continue
+		}
+		it := restoreItem{path: path, data: a.Files[path], outcome: restoreAdded}
+		if cur, ok := local.Files[path]; ok {
+			it.outcome = restoreConflict
+			if bytes.Equal(cur, it.data) {
+				it.outcome = restoreUnchanged
+			}
+		}
+		if it.outcome == restoreAdded && reencrypt != nil {
+			if it.data, err = reencrypt(path, it.data); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// reencryptFile re-encrypts the secrets in a vault file under a new master
+// password. Files without secrets are returned as they are.
+func reencryptFile(path string, data []byte, oldPass, newPass string) ([]byte, error) {
+	if _, ok := destinationFile(path); ok {
+		var d store.Destination
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, err
+		}
+		if err := reencryptDestination(oldPass, newPass, &d); err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(d, "", "  ")
+	}
+	if path == "ca.json" {
+		var authority store.CA
+		if err := json.Unmarshal(data, &authority); err != nil {
+			return nil, err
+		}
+		key, err := decryptSecret(oldPass, authority.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting CA key: %w", err)
+		}
+		if authority.PrivateKey, err = encryptSecret(newPass, key); err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(authority, "", "  ")
+	}
+	if path == "identity.json" {
+		var id store.Identity
+		if err := json.Unmarshal(data, &id); err != nil {
+			return nil, err
+		}
+		key, err := decryptSecret(oldPass, id.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting team identity: %w", err)
+		}
+		if id.PrivateKey, err = encryptSecret(newPass, key); err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(id, "", "  ")
+	}
+	if strings.HasPrefix(path, "recordings/") && strings.HasSuffix(path, ".enc") {
+		fmt.Fprintf(os.Stderr, "Warning: %s stays encrypted under the backup's master password.\n", path)
+	}
+	return data, nil
+}
+
+// decodeMaster decodes a master config's salt and password hash.
+func decodeMaster(m *store.MasterConfig) (salt, hash []byte, err error) {
+	if salt, err = hex.DecodeString(m.Salt); err != nil {
+		return nil, nil, fmt.Errorf("master.json salt: %w", err)
+	}
+	if hash, err = hex.DecodeString(m.PasswordHash); err != nil {
+		return nil, nil, fmt.Errorf("master.json hash: %w", err)
+	}
+	return salt, hash, nil
+}
+
+func sortedPaths(files map[string][]byte) []string {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"tele/internal/ca"
+	"tele/internal/store"
+)
+
+// certValidity is how long certificates minted for a connection last. They
+// are only needed for the login itself.
+const certValidity = 5 * time.Minute
+
+var (
+	caMu     sync.Mutex
+	caSigner ssh.Signer
+)
+
+// loadCASigner decrypts the CA key, once per process.
+func loadCASigner(masterPass string) (ssh.Signer, error) {
+	caMu.Lock()
+	defer caMu.Unlock()
+	if caSigner != nil {
+		return caSigner, nil
+	}
+	authority, err := store.ReadCA()
+	if err != nil {
+		return nil, err
+	}
+	if authority == nil {
+		return nil, fmt.Errorf("no certificate authority; run 'tele ca init' first")
+	}
+	pem, err := decryptSecret(masterPass, authority.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting CA key: %w", err)
+	}
+	auditCA()
+	signer, err := ssh.ParsePrivateKey(pem)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA key: %w", err)
+	}
+	caSigner = signer
+	return signer, nil
+}
+
+// principals returns the principals certificates for d are issued for.
+func principals(d *store.Destination) []string {
+	if len(d.Principals) > 0 {
+		return d.Principals
+	}
+	return []string{d.User}
+}
+
+// certIssuer returns a func minting a fresh short-lived certificate for d
+// on every call, so reconnects never present an expired one.
+func certIssuer(masterPass string, d *store.Destination) (func() (*ca.Issued, error), error) {
+	signer, err := loadCASigner(masterPass)
+	if err != nil {
+		return nil, err
+	}
+	keyID := fmt.Sprintf("tele:%s:%s@%s", localUser(), d.User, d.Host)
+	names := principals(d)
+	return func() (*ca.Issued, error) {
+		return ca.Issue(signer, keyID, names, certValidity)
+	}, nil
+}
+
+// localUser names the person running tele, for certificate key IDs.
+func localUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+func RunCA(args []string) {
+	usage := "Usage: tele ca init | trust | sign [--principal P]... [--validity D] [--id ID] (<key.pub> | --new <path>)"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "init":
+		runCAInit()
+	case "trust":
+		runCATrust()
+	case "sign":
+		runCASign(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+func runCAInit() {
+	requireInit()
+	existing, err := store.ReadCA()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if existing != nil {
+		fmt.Fprintln(os.Stderr, "A certificate authority already exists. Run 'tele ca trust' to see its key.")
+		os.Exit(1)
+	}
+
+	masterPass := verifyMasterPassword()
+
+	pub, priv, err := ca.GenerateKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating CA key: %v\n", err)
+		os.Exit(1)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "tele-ca")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	encrypted, err := encryptSecret(masterPass, pem.EncodeToMemory(block))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encrypting CA key: %v\n", err)
+		os.Exit(1)
+	}
+	authority := &store.CA{
+		PublicKey:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " tele-ca",
+		PrivateKey: encrypted,
+		Created:    time.Now(),
+	}
+	if err := store.WriteCA(authority); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving CA: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Certificate authority created.")
+	fmt.Println()
+	printTrustInstructions(authority)
+}
+
+func runCATrust() {
+	authority, err := store.ReadCA()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if authority == nil {
+		fmt.Fprintln(os.Stderr, "No certificate authority. Run 'tele ca init' first.")
+		os.Exit(1)
+	}
+	printTrustInstructions(authority)
+}
+
+func printTrustInstructions(authority *store.CA) {
+	fmt.Println("To let the CA's certificates log in to a server, save its key there:")
+	fmt.Println()
+	fmt.Printf("  echo '%s' | sudo tee /etc/ssh/tele_ca.pub\n", authority.PublicKey)
+	fmt.Println()
+	fmt.Println("then add this line to /etc/ssh/sshd_config and reload sshd:")
+	fmt.Println()
+	fmt.Println("  TrustedUserCAKeys /etc/ssh/tele_ca.pub")
+}
+
+func runCASign(args []string) {
+	fs := flag.NewFlagSet("ca sign", flag.ExitOnError)
+	var names stringList
+	fs.Var(&names, "principal", "user name the certificate is valid for (repeatable)")
+	validity := fs.Duration("validity", time.Hour, "how long the certificate is valid")
+	keyID := fs.String("id", "", "key ID recorded in server logs (default tele:<local user>)")
+	newKey := fs.String("new", "", "generate a new key pair at this path instead of signing an existing public key")
+	positional := parseInterspersed(fs, args)
+	if (*newKey == "") == (len(positional) != 1) || len(positional) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele ca sign [--principal P]... [--validity D] [--id ID] (<key.pub> | --new <path>)")
+		os.Exit(1)
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "Give at least one --principal.")
+		os.Exit(1)
+	}
+	if *keyID == "" {
+		*keyID = "tele:" + localUser()
+	}
+
+	requireInit()
+	masterPass := verifyMasterPassword()
+	signer, err := loadCASigner(masterPass)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var certPath string
+	var cert *ssh.Certificate
+	if *newKey != "" {
+		issued, err := ca.Issue(signer, *keyID, names, *validity)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error signing certificate: %v\n", err)
+			os.Exit(1)
+		}
+		keyPEM, err := issued.MarshalKey(*keyID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(*newKey, keyPEM, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing key: %v\n", err)
+			os.Exit(1)
+		}
+		pub := ssh.MarshalAuthorizedKey(issued.Cert.Key)
+		if err := os.WriteFile(*newKey+".pub", pub, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing public key: %v\n", err)
+			os.Exit(1)
+		}
+		cert = issued.Cert
+		certPath = *newKey + "-cert.pub"
+	} else {
+		data, err := os.ReadFile(positional[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing public key: %v\n", err)
+			os.Exit(1)
+		}
+		if cert, err = ca.Sign(signer, pub, *keyID, names, *validity); err != nil {
+			fmt.Fprintf(os.Stderr, "Error signing certificate: %v\n", err)
+			os.Exit(1)
+		}
+		certPath = strings.TrimSuffix(positional[0], ".pub") + "-cert.pub"
+	}
+
+	if err := os.WriteFile(certPath, ssh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing certificate: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s for %s, valid until %s.\n", certPath, strings.Join(names, ", "),
+		time.Unix(int64(cert.ValidBefore), 0).Format(time.RFC1123))
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"tele/internal/remote"
+	"tele/internal/store"
+)
+
+func RunCheck(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var tags stringList
+	fs.Var(&tags, "tag", "only check destinations with this tag (key or key=value, repeatable)")
+	parallel := fs.Int("parallel", 10, "maximum number of hosts to check at once")
+	timeout := fs.Duration("timeout", 5*time.Second, "per-host timeout")
+	asJSON := fs.Bool("json", false, "print results as JSON")
+	noAuth := fs.Bool("no-auth", false, "skip the credential check (no master password needed)")
+	pin := fs.Bool("pin", false, "pin the host key of destinations that have none yet")
+	repin := fs.Bool("repin", false, "also replace mismatched pins (requires explicit names)")
+	names := parseInterspersed(fs, args)
+
+	if *repin && len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "--repin needs the destinations to be named explicitly.")
+		os.Exit(1)
+	}
+
+	if *parallel < 1 {
+		fmt.Fprintln(os.Stderr, "--parallel must be at least 1.")
+		os.Exit(1)
+	}
+
+	requireInit()
+
+	names, err := selectDestinations(names, tags, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "No destinations match.")
+		os.Exit(1)
+	}
+
+	masterPass := ""
+	if !*noAuth {
+		masterPass = verifyMasterPassword()
+	}
+
+	dests := make([]*store.Destination, len(names))
+	creds := make([]remote.Credentials, len(names))
+	for i, name := range names {
+		d, err := store.LoadDestination(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		dests[i] = d
+		warnIgnoredOptions(name, d)
+		if masterPass == "" {
+			continue
+		}
+		creds[i], err = decryptCredentials(masterPass, d)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decrypting %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		auditDecrypt(name)
+	}
+
+	probes := make([]remote.ProbeResult, len(names))
+	sem := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	flushPins := batchPins()
+	for i := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			jump, err := dialJump(dests[i], creds[i], *timeout)
+			if err != nil {
+				probes[i] = remote.ProbeResult{Err: err}
+				return
+			}
+			if jump != nil {
+				defer jump.Close()
+			}
+			defer syncTOTP(names[i], creds[i])()
+			probes[i] = remote.ProbeVia(jump, dests[i], creds[i], *timeout)
+		}()
+	}
+	wg.Wait()
+
+	cache, err := store.ReadHealth()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not read health cache: %v\n", err)
+		cache = map[string]store.Health{}
+	}
+	now := time.Now()
+	results := make([]store.Health, len(names))
+	for i, name := range names {
+		p := probes[i]
+		h := store.Health{
+			Name:        name,
+			Checked:     now,
+			Reachable:   p.Reachable,
+			TCPLatency:  millis(p.TCPLatency),
+			Banner:      p.Banner,
+			HostKey:     p.HostKey,
+			Auth:        p.Auth,
+			AuthLatency: millis(p.AuthLatency),
+		}
+		if p.Err != nil {
+			h.Error = p.Err.Error()
+		}
+		results[i] = h
+		cache[name] = h
+
+		unpinned := p.HostKey == remote.HostKeyUnpinned
+		changed := p.HostKey == remote.HostKeyMismatch
+		if ((*pin || *repin) && unpinned) || (*repin && changed) {
+			dests[i].HostKey = p.PresentedKey
+			pinHostKey(name, dests[i])
+		}
+	}
+	flushPins()
+	if err := store.WriteHealth(cache); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not save health cache: %v\n", err)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		printCheckTable(results)
+	}
+
+	for _, h := range results {
+		if h.Status() != "ok" {
+			os.Exit(1)
+		}
+	}
+}
+
+func printCheckTable(results []store.Health) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tTCP\tAUTH\tHOST KEY\tBANNER")
+	for _, h := range results {
+		tcp, auth := "-", "-"
+		if h.Reachable {
+			tcp = fmt.Sprintf("%.0fms", h.TCPLatency)
+		}
+		if h.Auth != "" {
+			auth = h.Auth
+			if h.AuthLatency > 0 {
+				auth += fmt.Sprintf(" (%.0fms)", h.AuthLatency)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", h.Name, h.Status(), tcp, auth, orDash(h.HostKey), orDash(h.Banner))
+	}
+	tw.Flush()
+	for _, h := range results {
+		if h.Error != "" {
+			fmt.Printf("  %s: %s\n", h.Name, h.Error)
+		}
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
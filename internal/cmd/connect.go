@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"tele/internal/mux"
+	"tele/internal/remote"
+	"tele/internal/store"
+)
+
+// connect opens an SSH connection to a destination, through its shared
+// master if one is running. Otherwise it decrypts the credentials, asking
+// masterPass for the master password only then.
+func connect(name string, masterPass func() string) (*ssh.Client, error) {
+	if client, err := mux.Dial(name); err == nil {
+		return client, nil
+	}
+	d, err := store.LoadDestination(name)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	creds, err := decryptCredentials(masterPass(), d)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", name, err)
+	}
+	auditDecrypt(name)
+	return dialDestination(name, d, creds, remote.DefaultTimeout)
+}
+
+// dialDestination returns a connection to d: a channel on its shared master
+// if one is running, or on a new master when sharing is turned on, and a
+// direct connection otherwise.
+func dialDestination(name string, d *store.Destination, creds remote.Credentials, timeout time.Duration) (*ssh.Client, error) {
+	if client, err := mux.Dial(name); err == nil {
+		return client, nil
+	}
+	if idle := muxIdle(); idle > 0 && !creds.Empty() {
+		if err := startMaster(name, creds, idle); err != nil {
+			return nil, err
+		}
+		return mux.Dial(name)
+	}
+	return dialDirect(name, d, creds, timeout)
+}
+
+// dialDirect dials d, through its jump host if it has one, and, if this was
+// the first connection to it, saves the host key the server presented as
+// the destination's pin.
+func dialDirect(name string, d *store.Destination, creds remote.Credentials, timeout time.Duration) (*ssh.Client, error) {
+	defer syncTOTP(name, creds)()
+	warnIgnoredOptions(name, d)
+	pinned := d.HostKey
+	client, err := dialLogin(d, creds, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if pinned == "" && d.HostKey != "" {
+		pinHostKey(name, d)
+	}
+	return client, nil
+}
+
+// Commands such as exec and check connect to many destinations, and their
+// jump hosts, at once. Pins are saved one at a time under pinMu, and while
+// a batch is open they are recorded together when it is flushed, rather
+// than each starting its own git commit and ssh_config rewrite.
+var (
+	pinMu    sync.Mutex
+	batching bool
+	pinBatch []string
+)
+
+// pinHostKey saves d with the host key it presented on first contact.
+func pinHostKey(name string, d *store.Destination) {
+	pinMu.Lock()
+	defer pinMu.Unlock()
+	if err := store.SaveDestination(name, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not pin host key for %s: %v\n", name, err)
+		return
+	}
+	// A jump host shared by several destinations is pinned by each.
+	if batching && slices.Contains(pinBatch, name) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Pinned host key for %s (%s).\n", name, remote.Fingerprint(d.HostKey))
+	if batching {
+		pinBatch = append(pinBatch, name)
+		return
+	}
+	destinationsChanged("Pin host key of " + name)
+}
+
+// batchPins holds back recording pinned host keys until the returned func
+// is called.
+func batchPins() (flush func()) {
+	pinMu.Lock()
+	batching = true
+	pinMu.Unlock()
+	return func() {
+		pinMu.Lock()
+		names := pinBatch
+		batching, pinBatch = false, nil
+		pinMu.Unlock()
+		if len(names) > 0 {
+			slices.Sort(names)
+			destinationsChanged("Pin host key of " + strings.Join(names, ", "))
+		}
+	}
+}
+
+// dialLogin logs in to d with a new connection, through its jump host if
+// it has one.
+func dialLogin(d *store.Destination, creds remote.Credentials, timeout time.Duration) (*ssh.Client, error) {
+	jump, err := dialJump(d, creds, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if jump == nil {
+		return remote.Dial(d, creds, timeout)
+	}
+	client, err := remote.DialVia(jump, d, creds, timeout)
+	if err != nil {
+		jump.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// warnIgnoredOptions tells the user which of d's SSH options the built-in
+// client cannot honour.
+func warnIgnoredOptions(name string, d *store.Destination) {
+	if ignored := remote.IgnoredOptions(d.SSHOptions); len(ignored) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s: the built-in client ignores these SSH options: %s\n", name, strings.Join(ignored, ", "))
+	}
+}
+
+// syncTOTP primes creds' TOTP key with the last step any run used for name
+// and returns a func that records the step used by this one. Servers
+// usually refuse a code twice, even across separate logins.
+func syncTOTP(name string, creds remote.Credentials) func() {
+	if creds.TOTP == nil {
+		return func() {}
+	}
+	if step, err := store.TOTPStep(name); err == nil {
+		creds.TOTP.SetLastStep(step)
+		if wait := creds.TOTP.Wait(time.Now()); wait > 0 {
+			fmt.Fprintf(os.Stderr, "Waiting %s for a fresh TOTP code for %s...\n", wait.Round(time.Second), name)
+		}
+	}
+	return func() {
+		if err := store.RecordTOTPStep(name, creds.TOTP.LastStep()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not record TOTP use for %s: %v\n", name, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+
+	"tele/internal/store"
+	"tele/internal/transfer"
+)
+
+const cpUsage = "Usage: tele cp [-r] [-p] [-q] [-c] <src>... <dst>   (remote paths are name:path)"
+
+// endpoint is one side of a copy: a local path, or a path on a destination.
+type endpoint struct {
+	dest string
+	path string
+}
+
+// parseEndpoint splits "name:path" into a remote endpoint. Anything whose
+// prefix before the first colon contains a path separator is local.
+func parseEndpoint(s string) endpoint {
+	name, p, ok := strings.Cut(s, ":")
+	if ok && name != "" && !strings.ContainsAny(name, `/\`) {
+		if p == "" {
+			p = "."
+		}
+		return endpoint{dest: name, path: p}
+	}
+	return endpoint{path: s}
+}
+
+type cpFlags struct {
+	recursive, preserve, quiet, verify *bool
+}
+
+func newCpFlags(name string) (*flag.FlagSet, cpFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return fs, cpFlags{
+		recursive: fs.Bool("r", false, "copy directories recursively"),
+		preserve:  fs.Bool("p", false, "preserve permissions and modification times"),
+		quiet:     fs.Bool("q", false, "do not show progress bars"),
+		verify:    fs.Bool("c", false, "verify each copy with a SHA-256 checksum (always on between two destinations)"),
+	}
+}
+
+func RunCp(args []string) {
+	fs, f := newCpFlags("cp")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, cpUsage)
+		os.Exit(1)
+	}
+	runCopy(fs.Args(), f)
+}
+
+// RunPut uploads local files: tele put <name> <local>... <remote>.
+func RunPut(args []string) {
+	fs, f := newCpFlags("put")
+	fs.Parse(args)
+	if fs.NArg() < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: tele put [-r] [-p] [-q] [-c] <name> <local>... <remote-path>")
+		os.Exit(1)
+	}
+	rest := fs.Args()
+	name, srcs, dst := rest[0], rest[1:len(rest)-1], rest[len(rest)-1]
+	runCopy(append(srcs, name+":"+dst), f)
+}
+
+// RunGet downloads remote files: tele get <name> <remote>... <local>.
+func RunGet(args []string) {
+	fs, f := newCpFlags("get")
+	fs.Parse(args)
+	if fs.NArg() < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: tele get [-r] [-p] [-q] [-c] <name> <remote-path>... <local>")
+		os.Exit(1)
+	}
+	rest := fs.Args()
+	name, srcs, dst := rest[0], rest[1:len(rest)-1], rest[len(rest)-1]
+	var args2 []string
+	for _, s := range srcs {
+		args2 = append(args2, name+":"+s)
+	}
+	runCopy(append(args2, dst), f)
+}
+
+func runCopy(args []string, f cpFlags) {
+	dst := parseEndpoint(args[len(args)-1])
+	var srcs []string
+	srcDest := ""
+	for i, a := range args[:len(args)-1] {
+		e := parseEndpoint(a)
+		if i > 0 && e.dest != srcDest {
+			fmt.Fprintln(os.Stderr, "All sources must be on the same host.")
+			os.Exit(1)
+		}
+		srcDest = e.dest
+		srcs = append(srcs, e.path)
+	}
+	if srcDest == "" && dst.dest == "" {
+		fmt.Fprintln(os.Stderr, "Neither side is a destination; use name:path for the remote side.")
+		os.Exit(1)
+	}
+
+	requireInit()
+	for _, name := range []string{srcDest, dst.dest} {
+		if name == "" {
+			continue
+		}
+		exists, err := store.DestinationExists(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !exists {
+			fmt.Fprintf(os.Stderr, "Destination %q not found.\n", name)
+			os.Exit(1)
+		}
+	}
+
+	masterPass := lazyMasterPassword()
+
+	// Each remote side gets its own session; a remote-to-remote copy streams
+	// from one to the other through this process without touching local disk.
+	var sessions []*sftpSession
+	closeAll := func() {
+		for _, s := range sessions {
+			s.Close()
+		}
+	}
+	defer closeAll()
+	fail := func(err error) {
+		closeAll()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	open := func(name string) transfer.FS {
+		if name == "" {
+			return transfer.LocalFS{}
+		}
+		s, err := openSFTP(name, masterPass)
+		if err != nil {
+			fail(err)
+		}
+		sessions = append(sessions, s)
+		return transfer.RemoteFS{Client: s.Client, Conn: s.conn}
+	}
+	srcFS := open(srcDest)
+	dstFS := open(dst.dest)
+
+	if srcDest != "" {
+		var err error
+		if srcs, err = transfer.Expand(srcFS, srcs); err != nil {
+			fail(err)
+		}
+	}
+
+	opts := transfer.Options{
+		Recursive: *f.recursive,
+		Preserve:  *f.preserve,
+		Verify:    *f.verify || (srcDest != "" && dst.dest != ""),
+	}
+	if !*f.quiet && term.IsTerminal(int(os.Stderr.Fd())) {
+		opts.Progress = os.Stderr
+	}
+	stats, err := transfer.Copy(srcFS, srcs, dstFS, dst.path, opts)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Copied %d file(s), %s in %s (%s).\n", stats.Files,
+		transfer.FormatBytes(stats.Bytes), stats.Elapsed.Round(time.Millisecond), transfer.Rate(stats.Bytes, stats.Elapsed))
+	if opts.Verify {
+		fmt.Printf("Verified SHA-256 of %d file(s).\n", stats.Verified)
+	}
+}
+
+// sftpSession is an SFTP client that also closes its SSH connection.
+type sftpSession struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+func (s *sftpSession) Close() error {
+	s.Client.Close()
+	return s.conn.Close()
+}
+
+// openSFTP connects to a destination and starts the SFTP subsystem.
+func openSFTP(name string, masterPass func() string) (*sftpSession, error) {
+	conn, err := connect(name, masterPass)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("starting sftp on %s: %w", name, err)
+	}
+	return &sftpSession{Client: client, conn: conn}, nil
+}
@@ -0,0 +1,403 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tele/internal/audit"
+	"tele/internal/config"
+	"tele/internal/record"
+	"tele/internal/sshpass"
+	"tele/internal/store"
+)
+
+// vaultEntries are the files and directories tele keeps in its directory.
+var vaultEntries = map[string]bool{
+	"master.json": true, "health.json": true, "settings.json": true,
+	"ca.json": true, "identity.json": true, "ssh_config": true,
+	"known_hosts": true, "totp_steps.json": true, "audit.log": true, "audit.head": true,
+	"bin": true, "mux": true, "destinations": true, "recordings": true,
+}
+
+// doctor reports the outcome of each check, applying safe fixes when
+// asked to.
+type doctor struct {
+	fix      bool
+	problems int
+	fixed    int
+}
+
+func (dr *doctor) ok(what string) {
+	fmt.Printf("  ok       %s\n", what)
+}
+
+// problem reports something wrong with advice on what to do about it. fix,
+// if not nil, repairs it safely and is run with --fix.
+func (dr *doctor) problem(what, advice string, fix func() error) {
+	switch {
+	case fix != nil && dr.fix:
+		err := fix()
+		if err == nil {
+			fmt.Printf("  fixed    %s\n", what)
+			dr.fixed++
+			return
+		}
+		advice = fmt.Sprintf("fixing it failed: %v", err)
+	case fix != nil:
+		advice += " ('tele doctor --fix' does this)"
+	}
+	fmt.Printf("  problem  %s\n           %s\n", what, advice)
+	dr.problems++
+}
+
+func RunDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "apply the safe fixes: permissions and leftover temporary files")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: tele doctor [--fix]")
+		os.Exit(1)
+	}
+	requireInit()
+	dir, err := config.Dir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	dr := &doctor{fix: *fix}
+
+	fmt.Println("Vault")
+	masterPass := dr.checkMaster()
+	fmt.Println("Destinations")
+	dr.checkDestinations(masterPass)
+	fmt.Println("Files")
+	dr.checkFiles(dir)
+	fmt.Println("Permissions")
+	dr.checkPermissions(dir)
+	fmt.Println("Tools")
+	dr.checkTools()
+
+	fmt.Println()
+	switch {
+	case dr.problems == 0 && dr.fixed == 0:
+		fmt.Println("No problems found.")
+	case dr.problems == 0:
+		fmt.Printf("Fixed %d problem(s).\n", dr.fixed)
+	default:
+		fmt.Printf("%d problem(s) need attention", dr.problems)
+		if dr.fixed > 0 {
+			fmt.Printf("; fixed %d", dr.fixed)
+		}
+		fmt.Println(".")
+		os.Exit(1)
+	}
+}
+
+// checkMaster checks master.json and returns the vault secret, or "" if
+// the vault cannot be unlocked.
+func (dr *doctor) checkMaster() string {
+	mc, err := store.LoadMaster()
+	if err != nil {
+		dr.problem("master.json cannot be read: "+err.Error(),
+			"restore it from a backup with 'tele restore'; no secret can be decrypted without it", nil)
+		return ""
+	}
+	if _, _, err := decodeMaster(mc); err != nil {
+		dr.problem(err.Error(), "restore master.json from a backup with 'tele restore'", nil)
+		return ""
+	}
+	// Entering the password may finish an interrupted move to a vault key.
+	password, mc := readMasterPassword()
+	dr.ok("master.json parses and the master password matches")
+	if mc.VaultKey == nil {
+		return password
+	}
+	key, err := decryptSecret(password, mc.VaultKey)
+	if err != nil {
+		dr.problem("the vault key does not decrypt: "+err.Error(),
+			"recover it with 'tele recover' or 'tele recovery combine'", nil)
+		return ""
+	}
+	if check := hex.EncodeToString(vaultKeyCheck(key)); check != mc.VaultKeyCheck {
+		dr.problem("the vault key does not match its check value",
+			"master.json was edited or damaged; restore it from a backup", nil)
+		return ""
+	}
+	dr.ok("the vault key decrypts")
+	return hex.EncodeToString(key)
+}
+
+// checkDestinations parses every destination and decrypts its secrets.
+func (dr *doctor) checkDestinations(masterPass string) {
+	names, err := store.ListDestinations()
+	if err != nil {
+		dr.problem("destinations cannot be listed: "+err.Error(), "check that the destinations directory is readable", nil)
+		return
+	}
+	known := map[string]bool{}
+	for _, name := range names {
+		known[name] = true
+	}
+	healthy := 0
+	for _, name := range names {
+		d, err := store.LoadDestination(name)
+		if err != nil {
+			dr.problem(fmt.Sprintf("%s does not parse: %v", name, err),
+				fmt.Sprintf("restore it from a backup ('tele restore'), or remove it with 'tele rm %s'", name), nil)
+			continue
+		}
+		ok := true
+		if d.Host == "" {
+			dr.problem(name+" has no host", fmt.Sprintf("set one with 'tele edit %s'", name), nil)
+			ok = false
+		}
+		for _, hop := range strings.Split(d.ProxyJump, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" && !strings.ContainsAny(hop, "@:") && !known[hop] {
+				dr.problem(fmt.Sprintf("%s jumps through %s, which is not a destination", name, hop),
+					fmt.Sprintf("add %s, or change the jump host with 'tele edit %s'", hop, name), nil)
+				ok = false
+			}
+		}
+		if d.Auth == store.AuthKey {
+			if _, err := os.Stat(expandHome(d.IdentityFile)); err != nil {
+				dr.problem(fmt.Sprintf("%s's identity file is missing: %v", name, err),
+					fmt.Sprintf("restore the key, or point to another with 'tele edit %s'", name), nil)
+				ok = false
+			}
+		}
+		if masterPass != "" {
+			if err := decryptAll(masterPass, name, d); err != nil {
+				advice := fmt.Sprintf("restore it from a backup, or set its secrets again with 'tele edit %s'", name)
+				if len(d.Keys) > 0 {
+					advice = "ask a team member to run 'tele team rewrap' and 'tele sync'"
+				}
+				dr.problem(fmt.Sprintf("%s does not decrypt: %v", name, err), advice, nil)
+				ok = false
+			}
+		}
+		if ok {
+			healthy++
+		}
+	}
+	what := "parse"
+	if masterPass != "" {
+		what = "parse and decrypt"
+	}
+	if healthy == len(names) {
+		dr.ok(fmt.Sprintf("%d destination(s) %s", len(names), what))
+	} else if healthy > 0 {
+		dr.ok(fmt.Sprintf("%d other destination(s) %s", healthy, what))
+	}
+}
+
+// decryptAll decrypts every secret of d, and the CA key for certificate
+// destinations. Like any other command, it audits what it decrypted.
+func decryptAll(masterPass, name string, d *store.Destination) error {
+	decrypted := false
+	defer func() {
+		if decrypted {
+			auditDecrypt(name)
+		}
+	}()
+	if d.EncryptedPassword != "" {
+		if _, err := decryptPassword(masterPass, d); err != nil {
+			return fmt.Errorf("password: %w", err)
+		}
+		decrypted = true
+	}
+	if d.Pending != nil {
+		if _, err := decryptPassword(masterPass, d.PendingDestination()); err != nil {
+			return fmt.Errorf("pending password: %w", err)
+		}
+		decrypted = true
+	}
+	if key, err := decryptTOTP(masterPass, d); err != nil {
+		return err
+	} else if key != nil {
+		decrypted = true
+	}
+	if d.Auth == store.AuthCertificate {
+		if _, err := loadCASigner(masterPass); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFiles looks for files tele did not write or left behind.
+func (dr *doctor) checkFiles(dir string) {
+	before := dr.problems + dr.fixed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		dr.problem(err.Error(), "check that the tele directory is readable", nil)
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasSuffix(name, ".json") && vaultEntries[name]:
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			var v any
+			if err == nil {
+				err = json.Unmarshal(data, &v)
+			}
+			if err != nil {
+				dr.problem(fmt.Sprintf("%s does not parse: %v", name, err), "restore it from a backup with 'tele restore'", nil)
+			}
+		case vaultEntries[name]:
+		case isTempFile(name):
+			dr.tempFile(dir, name)
+		default:
+			dr.problem(name+" is not a file tele uses", "move it out of "+dir+" if it is yours, or remove it", nil)
+		}
+	}
+
+	destDir := filepath.Join(dir, "destinations")
+	if _, err := store.ReadTeam(); err != nil {
+		dr.problem(fmt.Sprintf("destinations/%s does not parse: %v", teamFile, err), "run 'tele sync' to take the remote's copy, or restore a backup", nil)
+	}
+	entries, _ = os.ReadDir(destDir)
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case name == ".git" || name == masterCopy || name == teamFile:
+		case isTempFile(name):
+			dr.tempFile(dir, filepath.Join("destinations", name))
+		case e.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, "."):
+			dr.problem("destinations/"+name+" is not a destination",
+				"move it out of the destinations directory, or remove it", nil)
+		}
+	}
+
+	recDir := filepath.Join(dir, "recordings")
+	entries, _ = os.ReadDir(recDir)
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case isTempFile(name):
+			dr.tempFile(dir, filepath.Join("recordings", name))
+		case !strings.HasSuffix(name, ".cast") && !strings.HasSuffix(name, ".cast"+record.EncryptedExt):
+			dr.problem("recordings/"+name+" is not a recording", "move it out of the recordings directory, or remove it", nil)
+		}
+	}
+
+	muxDir := filepath.Join(dir, "mux")
+	entries, _ = os.ReadDir(muxDir)
+	for _, e := range entries {
+		path := filepath.Join(muxDir, e.Name())
+		name, ok := strings.CutSuffix(e.Name(), ".sock")
+		if !ok {
+			dr.problem("mux/"+e.Name()+" is not a connection socket", "remove it", nil)
+			continue
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			continue
+		}
+		dr.problem(fmt.Sprintf("mux/%s is left from a shared connection to %s that has ended", e.Name(), name),
+			"remove it", func() error { return os.Remove(path) })
+	}
+
+	if dr.problems+dr.fixed == before {
+		dr.ok("no stray or leftover files")
+	}
+	n, err := audit.Verify()
+	switch {
+	case errors.Is(err, audit.ErrHeadBehind):
+		dr.ok(fmt.Sprintf("the audit log is intact (%d entries); audit.head lags its last entry after a failed write", n))
+	case err != nil:
+		dr.problem(fmt.Sprintf("the audit log has been tampered with: %v", err),
+			"keep a copy of audit.log and audit.head for investigation; the entries before the break are intact", nil)
+	case n > 0:
+		dr.ok(fmt.Sprintf("the audit log is intact (%d entries)", n))
+	}
+}
+
+func (dr *doctor) tempFile(dir, rel string) {
+	dr.problem(rel+" is a temporary file left by an interrupted write", "remove it",
+		func() error { return os.Remove(filepath.Join(dir, rel)) })
+}
+
+// isTempFile reports whether name is a temporary file tele writes before
+// renaming it into place.
+func isTempFile(name string) bool {
+	if strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, stagedExt) {
+		return true
+	}
+	// writeFileAtomic's temporary files are "."+name+".<random>".
+	return strings.HasPrefix(name, ".") && strings.Count(name, ".") >= 2 &&
+		name != masterCopy && name != teamFile
+}
+
+// checkPermissions checks that nothing in the tele directory is readable or
+// writable by anyone but its owner, as config.Dir intends.
+func (dr *doctor) checkPermissions(dir string) {
+	before := dr.problems + dr.fixed
+	filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			dr.problem(err.Error(), "check the ownership of "+dir, nil)
+			return nil
+		}
+		if e.IsDir() && e.Name() == ".git" {
+			// git manages its own files; the directory around it is enough.
+			return filepath.SkipDir
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		mode := info.Mode().Perm()
+		if mode&0077 == 0 {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		want := mode &^ 0077
+		dr.problem(fmt.Sprintf("%s is %#o; others can access it", rel, mode),
+			fmt.Sprintf("chmod %#o %s", want, path),
+			func() error { return os.Chmod(path, want) })
+		return nil
+	})
+	if dr.problems+dr.fixed == before {
+		dr.ok("only you can read the tele directory")
+	}
+}
+
+// checkTools checks for the programs tele runs.
+func (dr *doctor) checkTools() {
+	if p, err := exec.LookPath("ssh"); err == nil {
+		dr.ok("ssh is at " + p)
+	} else {
+		dr.problem("ssh is not installed", "install OpenSSH; 'tele go' runs ssh", nil)
+	}
+
+	if p, err := exec.LookPath("sshpass"); err == nil {
+		dr.ok("sshpass is at " + p)
+		return
+	}
+	bin, err := sshpass.BinDir()
+	if err == nil {
+		managed := filepath.Join(bin, "sshpass")
+		if info, err := os.Stat(managed); err == nil && info.Mode()&0100 != 0 {
+			dr.ok("sshpass is at " + managed)
+			return
+		}
+	}
+	for _, cc := range []string{"cc", "gcc", "clang"} {
+		if _, err := exec.LookPath(cc); err == nil {
+			dr.ok("sshpass is not installed; tele builds it with " + cc + " on first use")
+			return
+		}
+	}
+	dr.problem("sshpass is not installed and there is no C compiler to build it",
+		"install sshpass with your package manager, or a C compiler for tele to build it", nil)
+}
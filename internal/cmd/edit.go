@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"tele/internal/mux"
+	"tele/internal/store"
+)
+
+func RunEdit(args []string) {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	generate := fs.Bool("generate", false, "replace the stored password with a generated one")
+	genOpts := addGenFlags(fs)
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele edit [--generate [generator options]] <name>")
+		os.Exit(1)
+	}
+	name := positional[0]
+
+	requireInit()
+
+	destExists, err := store.DestinationExists(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !destExists {
+		fmt.Fprintf(os.Stderr, "Destination %q not found.\n", name)
+		os.Exit(1)
+	}
+
+	masterPass := verifyMasterPassword()
+
+	d, err := store.LoadDestination(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading destination: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Press Enter to keep the current value.")
+
+	if d.Host, err = promptLine("Host", d.Host); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if d.Port, err = promptLine("Port", d.Port); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if d.User, err = promptLine("User", d.User); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	hadPassword := d.Auth == store.AuthPassword
+	if err := promptAuth(d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var destPass string
+	switch {
+	case d.Auth != store.AuthPassword:
+		// No password is kept for certificate and key destinations.
+		d.SetCiphertext(nil, nil, nil)
+		d.Pending = nil
+	case *generate:
+		destPass = generatePassword(genOpts)
+		fmt.Printf("Password: %s\n", destPass)
+	case !hadPassword:
+		fmt.Print("Password: ")
+		destPass, err = readPassword()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError reading password: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println()
+		if destPass == "" {
+			fmt.Fprintln(os.Stderr, "Password cannot be empty.")
+			os.Exit(1)
+		}
+	default:
+		fmt.Print("Password (leave empty to keep): ")
+		destPass, err = readPassword()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError reading password: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println()
+	}
+
+	if err := promptTOTP(masterPass, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := promptSettings(d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if destPass != "" {
+		if err := encryptPassword(masterPass, []byte(destPass), d); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encrypting password: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := store.SaveDestination(name, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving destination: %v\n", err)
+		os.Exit(1)
+	}
+
+	auditChange(name)
+	destinationsChanged("Edit " + name)
+	if mux.Stop(name) == nil {
+		fmt.Println("Stopped its shared connection so the next one uses the new settings.")
+	}
+	fmt.Printf("Destination %q updated.\n", name)
+}
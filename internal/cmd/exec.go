@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tele/internal/remote"
+	"tele/internal/store"
+)
+
+type execStatus int
+
+const (
+	execOK execStatus = iota
+	execFailed
+	execTimeout
+)
+
+type execResult struct {
+	name     string
+	status   execStatus
+	exitCode int
+	err      error
+	elapsed  time.Duration
+}
+
+type execJob struct {
+	name  string
+	dest  *store.Destination
+	creds remote.Credentials
+}
+
+func RunExec(args []string) {
+	flagArgs, command, ok := splitCommand(args)
+	if !ok || len(command) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: tele exec [--tag k=v] [--all] [--parallel N] [--timeout D] [--out-dir DIR] [--sudo] [name...] -- <command>")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	var tags stringList
+	fs.Var(&tags, "tag", "only run on destinations with this tag (key or key=value, repeatable)")
+	all := fs.Bool("all", false, "run on every destination")
+	parallel := fs.Int("parallel", 5, "maximum number of hosts to run on at once")
+	timeout := fs.Duration("timeout", time.Minute, "per-host timeout, including connect (0 disables)")
+	outDir := fs.String("out-dir", "", "also write each host's output to DIR/<name>.out")
+	sudo := fs.Bool("sudo", false, "run the command through sudo, answering its prompt with the stored password")
+	fs.Parse(flagArgs)
+
+	if *parallel < 1 {
+		fmt.Fprintln(os.Stderr, "--parallel must be at least 1.")
+		os.Exit(1)
+	}
+
+	requireInit()
+
+	names, err := selectDestinations(fs.Args(), tags, *all)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "No destinations match.")
+		os.Exit(1)
+	}
+
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0700); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output dir: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	masterPass := lazyMasterPassword()
+
+	// Decrypt up front: each derivation allocates Argon2's full memory cost,
+	// so doing it inside the workers would multiply that by --parallel.
+	// Destinations with a shared master need no credentials, unless sudo
+	// needs the password.
+	jobs := make([]execJob, 0, len(names))
+	for _, name := range names {
+		d, err := store.LoadDestination(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		if !*sudo && masterRunning(name) {
+			jobs = append(jobs, execJob{name: name, dest: d})
+			continue
+		}
+		if *sudo && d.Auth != store.AuthPassword {
+			fmt.Fprintf(os.Stderr, "Error: %s logs in with a %s and has no password for sudo.\n", name, authName(d.Auth))
+			os.Exit(1)
+		}
+		creds, err := decryptCredentials(masterPass(), d)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decrypting %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		auditDecrypt(name)
+		jobs = append(jobs, execJob{name: name, dest: d, creds: creds})
+	}
+
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+
+	cmdline := strings.Join(command, " ")
+	var mu sync.Mutex
+	results := make([]execResult, len(jobs))
+	sem := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	flushPins := batchPins()
+	for i, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			prefix := fmt.Sprintf("[%-*s] ", width, job.name)
+			stdout := &prefixWriter{mu: &mu, out: os.Stdout, prefix: prefix}
+			stderr := &prefixWriter{mu: &mu, out: os.Stderr, prefix: prefix}
+			var outW, errW io.Writer = stdout, stderr
+			if *outDir != "" {
+				f, err := os.OpenFile(filepath.Join(*outDir, job.name+".out"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+				if err != nil {
+					results[i] = execResult{name: job.name, status: execFailed, err: err}
+					return
+				}
+				defer f.Close()
+				outW = io.MultiWriter(stdout, f)
+				errW = io.MultiWriter(stderr, f)
+			}
+			var secret string
+			if *sudo {
+				secret = job.creds.Password
+			}
+			// The password is never echoed, but mask it anyway in case a
+			// command prints it.
+			outR := remote.NewRedactor(outW, secret)
+			errR := remote.NewRedactor(errW, secret)
+			results[i] = execOne(job, cmdline, *sudo, outR, errR, *timeout)
+			outR.Flush()
+			errR.Flush()
+			stdout.Flush()
+			stderr.Flush()
+		}()
+	}
+	wg.Wait()
+	flushPins()
+
+	if !printExecSummary(results) {
+		os.Exit(1)
+	}
+}
+
+// execOne runs a command on a single destination, enforcing the timeout
+// by closing the connection if it fires.
+func execOne(job execJob, command string, sudo bool, stdout, stderr io.Writer, timeout time.Duration) execResult {
+	start := time.Now()
+	res := execResult{name: job.name}
+
+	var timedOut bool
+	var closeMu sync.Mutex
+	var closer io.Closer
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			closeMu.Lock()
+			defer closeMu.Unlock()
+			timedOut = true
+			if closer != nil {
+				closer.Close()
+			}
+		})
+		defer timer.Stop()
+	}
+
+	dialTimeout := remote.DefaultTimeout
+	if timeout > 0 && timeout < dialTimeout {
+		dialTimeout = timeout
+	}
+	client, err := dialDestination(job.name, job.dest, job.creds, dialTimeout)
+
+	closeMu.Lock()
+	if err == nil {
+		closer = client
+		if timedOut {
+			client.Close()
+		}
+	}
+	expired := timedOut
+	closeMu.Unlock()
+
+	if err == nil && !expired {
+		defer client.Close()
+		if sudo {
+			res.exitCode, err = remote.RunSudo(client, command, job.creds.Password, stdout, stderr)
+		} else {
+			res.exitCode, err = remote.Run(client, command, nil, stdout, stderr)
+		}
+	}
+	res.elapsed = time.Since(start)
+
+	closeMu.Lock()
+	expired = timedOut
+	closeMu.Unlock()
+	switch {
+	case expired:
+		res.status = execTimeout
+	case err != nil:
+		res.status = execFailed
+		res.err = err
+	case res.exitCode != 0:
+		res.status = execFailed
+	default:
+		res.status = execOK
+	}
+	return res
+}
+
+// printExecSummary reports per-status counts and details, returning true
+// if every host succeeded.
+func printExecSummary(results []execResult) bool {
+	var ok, failed, timedOut int
+	for _, r := range results {
+		switch r.status {
+		case execOK:
+			ok++
+		case execFailed:
+			failed++
+		case execTimeout:
+			timedOut++
+		}
+	}
+
+	fmt.Printf("\n%d succeeded, %d failed, %d timed out\n", ok, failed, timedOut)
+	for _, r := range results {
+		switch {
+		case r.status == execTimeout:
+			fmt.Printf("  timeout  %s (after %s)\n", r.name, r.elapsed.Round(time.Millisecond))
+		case r.status == execFailed && r.err != nil:
+			fmt.Printf("  failed   %s: %v\n", r.name, r.err)
+		case r.status == execFailed:
+			fmt.Printf("  failed   %s (exit %d)\n", r.name, r.exitCode)
+		}
+	}
+	return failed == 0 && timedOut == 0
+}
+
+// prefixWriter prefixes each complete line written to it and serializes
+// writes to a shared output through mu.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    bytes.Buffer
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			// Incomplete line: keep it until more output or Flush.
+			w.buf.Reset()
+			w.buf.Write(line)
+			break
+		}
+		w.emit(line)
+	}
+	return len(p), nil
+}
+
+// Flush writes any trailing partial line.
+func (w *prefixWriter) Flush() {
+	if w.buf.Len() == 0 {
+		return
+	}
+	line := append(w.buf.Bytes(), '\n')
+	w.buf.Reset()
+	w.emit(line)
+}
+
+func (w *prefixWriter) emit(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+}
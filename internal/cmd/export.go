@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"tele/internal/config"
+	"tele/internal/sshconfig"
+	"tele/internal/store"
+)
+
+func RunExport(args []string) {
+	usage := "Usage: tele export ssh-config"
+	if len(args) != 1 || args[0] != "ssh-config" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	path, n, err := writeSSHConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %d host(s) to %s.\n", n, path)
+	fmt.Println()
+	fmt.Println("To use them with ssh, scp, rsync and other OpenSSH tools, add this line")
+	fmt.Println("near the top of ~/.ssh/config, before any Host or Match block:")
+	fmt.Println()
+	fmt.Printf("  Include %s\n", path)
+	fmt.Println()
+	fmt.Println("The file is kept up to date as destinations are added, edited and removed.")
+}
+
+// sshConfigPaths returns where the exported ssh_config and its known_hosts
+// file live.
+func sshConfigPaths() (cfgPath, knownHostsPath string, err error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(dir, "ssh_config"), filepath.Join(dir, "known_hosts"), nil
+}
+
+// writeSSHConfig exports every destination as a Host block, with pinned
+// host keys in a known_hosts file beside it. It returns the config's path
+// and the number of hosts written.
+func writeSSHConfig() (string, int, error) {
+	cfgPath, knownHostsPath, err := sshConfigPaths()
+	if err != nil {
+		return "", 0, err
+	}
+	names, err := store.ListDestinations()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var hosts []sshconfig.Host
+	for _, name := range names {
+		if !sshConfigName(name) {
+			continue
+		}
+		d, err := store.LoadDestination(name)
+		if err != nil {
+			return "", 0, fmt.Errorf("reading %s: %w", name, err)
+		}
+		h := sshconfig.Host{
+			Alias:     name,
+			HostName:  d.Host,
+			Port:      d.Port,
+			User:      d.User,
+			ProxyJump: d.ProxyJump,
+			Options:   d.SSHOptions,
+		}
+		switch d.Auth {
+		case store.AuthKey:
+			h.IdentityFile = expandHome(d.IdentityFile)
+		case store.AuthCertificate:
+			h.Comment = "logs in with tele's certificates; sign a key with 'tele ca sign' to use it here"
+		default:
+			h.Comment = "logs in with a password; 'tele go " + name + "' types it for you"
+		}
+		if d.HostKey != "" {
+			h.HostKeyAlias = hostKeyAlias(name)
+			h.KnownHostsFile = knownHostsPath
+		}
+		if err := h.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; left it out of %s.\n", err, filepath.Base(cfgPath))
+			continue
+		}
+		hosts = append(hosts, h)
+	}
+
+	var cfg bytes.Buffer
+	header := []string{
+		"Generated by tele from its destinations. Do not edit: changes are",
+		"overwritten whenever a destination is added, edited or removed.",
+	}
+	if err := sshconfig.Write(&cfg, header, hosts); err != nil {
+		return "", 0, err
+	}
+	data, rejected := rejectBadLines(cfg.Bytes())
+	for _, line := range rejected {
+		fmt.Fprintf(os.Stderr, "Warning: ssh rejects %q; left it out of %s.\n", line, filepath.Base(cfgPath))
+	}
+	if _, err := writeKnownHosts(); err != nil {
+		return "", 0, err
+	}
+	if err := writeFileAtomic(cfgPath, data); err != nil {
+		return "", 0, err
+	}
+	return cfgPath, len(hosts), nil
+}
+
+// hostKeyAlias is the name a destination's pinned key has in tele's
+// known_hosts file. It is keyed by name, so hosts reached through
+// different jump hosts at the same private address keep their own keys.
+func hostKeyAlias(name string) string {
+	return "tele." + name
+}
+
+// writeKnownHosts writes every destination's pinned host key to tele's
+// known_hosts file and returns its path.
+func writeKnownHosts() (string, error) {
+	_, path, err := sshConfigPaths()
+	if err != nil {
+		return "", err
+	}
+	names, err := store.ListDestinations()
+	if err != nil {
+		return "", err
+	}
+	var knownHosts bytes.Buffer
+	for _, name := range names {
+		if !sshConfigName(name) {
+			continue
+		}
+		d, err := store.LoadDestination(name)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", name, err)
+		}
+		if d.HostKey != "" && !strings.ContainsAny(d.HostKey, "\r\n") {
+			fmt.Fprintf(&knownHosts, "%s %s\n", hostKeyAlias(name), d.HostKey)
+		}
+	}
+	return path, writeFileAtomic(path, knownHosts.Bytes())
+}
+
+var sshErrorLine = regexp.MustCompile(`line (\d+): `)
+
+// rejectBadLines has ssh parse the config and comments out each line it
+// rejects, such as a mistyped SSH option: ssh refuses to run at all with a
+// bad line in a file it includes. Without ssh installed it returns data as
+// is.
+func rejectBadLines(data []byte) ([]byte, []string) {
+	sshPath, err := exec.LookPath("ssh")
+	if err != nil {
+		return data, nil
+	}
+	tmp, err := os.CreateTemp("", "tele-ssh-config-*")
+	if err != nil {
+		return data, nil
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+
+	var rejected []string
+	for range 20 {
+		if err := os.WriteFile(tmp.Name(), data, 0600); err != nil {
+			break
+		}
+		out, err := exec.Command(sshPath, "-G", "-F", tmp.Name(), "tele-check").CombinedOutput()
+		if err == nil {
+			break
+		}
+		m := sshErrorLine.FindSubmatch(out)
+		if m == nil {
+			break
+		}
+		n, _ := strconv.Atoi(string(m[1]))
+		lines := strings.Split(string(data), "\n")
+		if n < 1 || n > len(lines) {
+			break
+		}
+		bad := strings.TrimSpace(lines[n-1])
+		rejected = append(rejected, bad)
+		lines[n-1] = "    # rejected by ssh: " + bad
+		data = []byte(strings.Join(lines, "\n"))
+	}
+	return data, rejected
+}
+
+// refreshSSHConfig rewrites the exported ssh_config after destinations
+// change, if it has been exported at all.
+func refreshSSHConfig() {
+	cfgPath, _, err := sshConfigPaths()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(cfgPath); err != nil {
+		return
+	}
+	if _, _, err := writeSSHConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not update %s: %v\n", cfgPath, err)
+	}
+}
+
+// writeFileAtomic replaces path with data, so ssh never reads a half
+// written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// sshConfigName reports whether name can be written as a Host alias.
+func sshConfigName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t*?!\"#")
+}
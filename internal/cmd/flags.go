@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"tele/internal/store"
+)
+
+// stringList is a flag.Value that collects every occurrence of a repeated flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments, returning the positionals in order.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...)
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// splitCommand splits args at the first "--", returning the flag and
+// command halves. ok is false when no separator is present.
+func splitCommand(args []string) (flags, command []string, ok bool) {
+	for i, a := range args {
+		if a == "--" {
+			return args[:i], args[i+1:], true
+		}
+	}
+	return args, nil, false
+}
+
+// selectDestinations resolves explicit names (or every destination when
+// all is set) and keeps those matching every tag filter.
+func selectDestinations(names, tags []string, all bool) ([]string, error) {
+	if len(names) == 0 {
+		if len(tags) == 0 && !all {
+			return nil, fmt.Errorf("no destinations selected; name some, or use --tag or --all")
+		}
+		var err error
+		names, err = store.ListDestinations()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var selected []string
+	for _, name := range names {
+		d, err := store.LoadDestination(name)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("destination %q not found", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		if d.MatchTags(tags) {
+			selected = append(selected, name)
+		}
+	}
+	return selected, nil
+}
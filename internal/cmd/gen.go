@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"tele/internal/passgen"
+)
+
+// addGenFlags registers the password generator options on fs.
+func addGenFlags(fs *flag.FlagSet) *passgen.Options {
+	opts := &passgen.Options{}
+	fs.IntVar(&opts.Length, "length", passgen.DefaultLength, "length of the generated password")
+	fs.BoolVar(&opts.NoLower, "no-lower", false, "leave out lower case letters")
+	fs.BoolVar(&opts.NoUpper, "no-upper", false, "leave out upper case letters")
+	fs.BoolVar(&opts.NoDigits, "no-digits", false, "leave out digits")
+	fs.BoolVar(&opts.NoSymbols, "no-symbols", false, "leave out symbols")
+	fs.BoolVar(&opts.ExcludeAmbiguous, "exclude-ambiguous", false, "leave out characters that are easily confused (Il1O0o)")
+	fs.IntVar(&opts.Words, "words", 0, "generate a passphrase of this many words instead")
+	fs.StringVar(&opts.Separator, "separator", "-", "separator between passphrase words")
+	return opts
+}
+
+// generatePassword runs the generator, reporting the entropy estimate on
+// stderr, and exits on failure.
+func generatePassword(opts *passgen.Options) string {
+	pw, bits, err := passgen.New(*opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating password: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Generated password with about %.0f bits of entropy.\n", bits)
+	return pw
+}
+
+func RunGen(args []string) {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	opts := addGenFlags(fs)
+	count := fs.Int("count", 1, "number of passwords to generate")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: tele gen [--length N] [--no-lower] [--no-upper] [--no-digits] [--no-symbols] [--exclude-ambiguous] [--words N] [--separator S] [--count N]")
+		os.Exit(1)
+	}
+
+	for i := 0; i < *count; i++ {
+		pw, bits, err := passgen.New(*opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if i == 0 {
+			fmt.Fprintf(os.Stderr, "Entropy: about %.0f bits\n", bits)
+		}
+		fmt.Println(pw)
+	}
+}
@@ -1,16 +1,39 @@
 package cmd
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/exec"
+	"os/signal"
 	"syscall"
+	"time"
 
-	"tele/internal/crypto"
+	"tele/internal/remote"
 	"tele/internal/sshpass"
 	"tele/internal/store"
 )
 
-func RunGo(name string) {
+func RunGo(args []string) {
+	fs := flag.NewFlagSet("go", flag.ExitOnError)
+	rec := fs.Bool("record", false, "record the session in asciicast v2 format")
+	encrypt := fs.Bool("encrypt", false, "record the session encrypted with the vault key (implies --record)")
+	reconnect := fs.Bool("reconnect", false, "redial automatically when the connection drops")
+	keepalive := fs.Duration("keepalive", 15*time.Second, "keepalive interval for built-in sessions (0 disables)")
+	attach := fs.String("attach", "", "start or reattach a remote tmux or screen session")
+	sessionName := fs.String("session", "tele", "name of the remote tmux or screen session for --attach")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele go [--record] [--encrypt] [--reconnect] [--attach tmux|screen] <name>")
+		os.Exit(1)
+	}
+	if *attach != "" && *attach != "tmux" && *attach != "screen" {
+		fmt.Fprintln(os.Stderr, "--attach must be tmux or screen.")
+		os.Exit(1)
+	}
+	name := positional[0]
+
 	exists, err := store.MasterExists()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -31,37 +54,141 @@ func RunGo(name string) {
 		os.Exit(1)
 	}
 
-	masterPass := verifyMasterPassword()
-
-	host, port, user, encPass, nonce, salt, err := store.ReadDestination(name)
+	d, err := store.LoadDestination(name)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading destination: %v\n", err)
 		os.Exit(1)
 	}
 
-	key := crypto.DeriveKey(masterPass, salt)
-	destPass, err := crypto.Decrypt(encPass, nonce, key)
+	hooks, err := loadHooks(d)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error decrypting password: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error reading settings: %v\n", err)
 		os.Exit(1)
 	}
+	if err := hooks.runPreHooks(name, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Not connecting.")
+		os.Exit(1)
+	}
+
+	recordMode := d.Record
+	if *rec && recordMode == store.RecordOff {
+		recordMode = store.RecordOn
+	}
+	if *encrypt {
+		recordMode = store.RecordEncrypted
+	}
+
+	// A shared connection skips the master password, unless the session
+	// needs the password itself or must be able to log in again.
+	shared := masterRunning(name) && !d.AutoSudo && !*reconnect && recordMode != store.RecordEncrypted
+
+	// sshpass only answers the login prompt, so hosts that also want a
+	// verification code, certificates, jump hosts, sudo auto-answering and
+	// shared connections need the built-in client.
+	builtin := recordMode != store.RecordOff || *reconnect || *attach != "" || d.TOTP != nil || d.AutoSudo ||
+		d.Auth == store.AuthCertificate || d.ProxyJump != "" || shared || muxIdle() > 0
+
+	// Plain ssh logs in with an identity file by itself.
+	var masterPass string
+	var creds remote.Credentials
+	if !shared && (builtin || d.Auth != store.AuthKey) {
+		masterPass = verifyMasterPassword()
+		creds, err = decryptCredentials(masterPass, d)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decrypting password: %v\n", err)
+			os.Exit(1)
+		}
+		auditDecrypt(name)
+	}
+
+	if builtin {
+		opts := sessionOptions{
+			record:      recordMode != store.RecordOff,
+			reconnect:   *reconnect,
+			keepalive:   *keepalive,
+			attach:      *attach,
+			sessionName: *sessionName,
+			sudo:        d.AutoSudo && creds.Password != "",
+		}
+		if recordMode == store.RecordEncrypted {
+			opts.recordKey = masterPass
+		}
+		start := time.Now()
+		code := goBuiltin(name, d, creds, opts)
+		hooks.runPostHooks(name, d, code, time.Since(start))
+		os.Exit(code)
+	}
 
-	sshpassPath, err := sshpass.Ensure()
+	var path string
+	if d.Auth == store.AuthKey {
+		path, err = exec.LookPath("ssh")
+		args = []string{"ssh", "-i", expandHome(d.IdentityFile), "-o", "IdentitiesOnly=yes"}
+	} else {
+		path, err = sshpass.Ensure()
+		args = []string{"sshpass", "-p", creds.Password, "ssh"}
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	args := []string{
-		"sshpass", "-p", string(destPass),
-		"ssh",
-		"-o", "StrictHostKeyChecking=no",
-		"-p", port,
-		fmt.Sprintf("%s@%s", user, host),
+	if d.HostKey != "" && sshConfigName(name) {
+		// Check the pinned key, as the built-in client does.
+		knownHosts, err := writeKnownHosts()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		args = append(args,
+			"-o", "StrictHostKeyChecking=yes",
+			"-o", `UserKnownHostsFile="`+knownHosts+`"`,
+			"-o", "GlobalKnownHostsFile=/dev/null",
+			"-o", "HostKeyAlias="+hostKeyAlias(name))
+	} else {
+		args = append(args, "-o", "StrictHostKeyChecking=no")
+	}
+	for _, opt := range d.SSHOptions {
+		args = append(args, "-o", opt)
+	}
+	args = append(args, "-p", d.Port, fmt.Sprintf("%s@%s", d.User, d.Host))
+	if startup := remote.StartupCommand(d); startup != "" {
+		// A remote command suppresses ssh's automatic pty allocation.
+		args = append(args, "-t", startup)
+	}
+
+	if len(hooks.post) > 0 {
+		// Post hooks need tele to outlive ssh, so run it as a child.
+		start := time.Now()
+		code := runChild(path, args)
+		hooks.runPostHooks(name, d, code, time.Since(start))
+		os.Exit(code)
 	}
 
-	if err := syscall.Exec(sshpassPath, args, os.Environ()); err != nil {
+	if err := syscall.Exec(path, args, os.Environ()); err != nil {
 		fmt.Fprintf(os.Stderr, "Error executing ssh: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// runChild runs an interactive program attached to the terminal and returns
+// its exit code. Terminal signals are left to the child.
+func runChild(path string, args []string) int {
+	signal.Ignore(os.Interrupt, syscall.SIGQUIT)
+	defer signal.Reset(os.Interrupt, syscall.SIGQUIT)
+
+	c := exec.Command(path, args[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error executing ssh: %v\n", err)
+		return 1
+	}
+	return 0
+}
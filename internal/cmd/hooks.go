@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"tele/internal/store"
+)
+
+// hookSet is the pre and post hooks that apply to one connection, global
+// ones first.
+type hookSet struct {
+	pre  []string
+	post []string
+}
+
+// loadHooks collects the global and per-destination hooks for d.
+func loadHooks(d *store.Destination) (hookSet, error) {
+	s, err := store.ReadSettings()
+	if err != nil {
+		return hookSet{}, err
+	}
+	var h hookSet
+	for _, c := range []string{s.PreHook, d.PreHook} {
+		if c != "" {
+			h.pre = append(h.pre, c)
+		}
+	}
+	// Post hooks unwind in reverse, so the destination's runs first.
+	for _, c := range []string{d.PostHook, s.PostHook} {
+		if c != "" {
+			h.post = append(h.post, c)
+		}
+	}
+	return h, nil
+}
+
+// runPreHooks runs each pre hook in turn, stopping at the first failure.
+func (h hookSet) runPreHooks(name string, d *store.Destination) error {
+	for _, c := range h.pre {
+		if err := runHook(c, hookEnv("pre", name, d)); err != nil {
+			return fmt.Errorf("pre-connect hook %q: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// runPostHooks runs every post hook with the session's outcome, warning
+// about failures since the session is already over.
+func (h hookSet) runPostHooks(name string, d *store.Destination, exitCode int, elapsed time.Duration) {
+	env := append(hookEnv("post", name, d),
+		"TELE_EXIT_CODE="+strconv.Itoa(exitCode),
+		"TELE_DURATION="+strconv.Itoa(int(elapsed.Seconds())),
+	)
+	for _, c := range h.post {
+		if err := runHook(c, env); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: post-disconnect hook %q: %v\n", c, err)
+		}
+	}
+}
+
+// hookEnv describes the destination to a hook. The password and other
+// secrets are deliberately left out.
+func hookEnv(phase, name string, d *store.Destination) []string {
+	return []string{
+		"TELE_HOOK=" + phase,
+		"TELE_NAME=" + name,
+		"TELE_HOST=" + d.Host,
+		"TELE_PORT=" + d.Port,
+		"TELE_USER=" + d.User,
+		"TELE_TAGS=" + store.FormatPairs(d.Tags),
+	}
+}
+
+// runHook runs a hook command through the shell, attached to the terminal.
+func runHook(command string, env []string) error {
+	c := exec.Command("/bin/sh", "-c", command)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.Env = append(os.Environ(), env...)
+	return c.Run()
+}
+
+// RunHooks edits the global hooks that run around every `tele go`.
+func RunHooks() {
+	requireInit()
+
+	s, err := store.ReadSettings()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading settings: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Press Enter to keep the current value.")
+	if s.PreHook, err = promptOptional("Pre-connect hook (all destinations)", s.PreHook); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if s.PostHook, err = promptOptional("Post-disconnect hook (all destinations)", s.PostHook); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := store.WriteSettings(s); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving settings: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Hooks updated.")
+}
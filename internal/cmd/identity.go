@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// expandHome replaces a leading ~ with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// loadIdentity reads a private key file, asking for its passphrase if it
+// is encrypted.
+func loadIdentity(path string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("reading identity file: %w", err)
+	}
+	key, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		fmt.Printf("Passphrase for %s: ", path)
+		passphrase, perr := readPassword()
+		fmt.Println()
+		if perr != nil {
+			return nil, perr
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing identity file %s: %w", path, err)
+	}
+	// ssh.MarshalPrivateKey, used to hand the key to a mux master, only
+	// takes ed25519 keys by value.
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		return *k, nil
+	}
+	return key, nil
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"tele/internal/sshconfig"
+	"tele/internal/store"
+)
+
+func RunImport(args []string) {
+	usage := `Usage: tele import ssh-config [--dry-run] [path]
+       tele import keepass|bitwarden|csv [--folder <name>] [--dry-run] <file>
+       tele import putty|mobaxterm [--folder <name>] [--dry-run] <file>`
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "ssh-config":
+		runImportSSHConfig(args[1:])
+	case "keepass", "bitwarden", "csv":
+		runImportPasswords(args[0], args[1:])
+	case "putty", "mobaxterm":
+		runImportSessions(args[0], args[1:])
+	case "termius":
+		// Termius keeps its hosts in its own synced vault, with no export.
+		fmt.Fprintln(os.Stderr, "Termius cannot export its hosts to a file, so tele cannot import them.")
+		fmt.Fprintln(os.Stderr, "Hosts that are also in ~/.ssh/config can be imported with 'tele import ssh-config'; add the rest with 'tele add'.")
+		os.Exit(1)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+// importCandidate is a destination about to be imported, or the reason it
+// will not be.
+type importCandidate struct {
+	name string
+	dest *store.Destination
+	skip string
+}
+
+func runImportSSHConfig(args []string) {
+	fs := flag.NewFlagSet("import ssh-config", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "show what would be imported without saving anything")
+	positional := parseInterspersed(fs, args)
+	if len(positional) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele import ssh-config [--dry-run] [path]")
+		os.Exit(1)
+	}
+	path := "~/.ssh/config"
+	if len(positional) == 1 {
+		path = positional[0]
+	}
+
+	requireInit()
+
+	cfg, err := sshconfig.Parse(expandHome(path))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	aliases, patterns := cfg.Aliases()
+	for _, w := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	for _, p := range patterns {
+		fmt.Fprintf(os.Stderr, "Warning: skipping pattern %q; its options still apply to the hosts it matches.\n", p)
+	}
+
+	candidates := make([]importCandidate, 0, len(aliases))
+	importing := map[string]bool{}
+	for _, alias := range aliases {
+		c := importCandidate{name: alias}
+		exists, err := store.DestinationExists(alias)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		case strings.ContainsRune(alias, filepath.Separator) || strings.HasPrefix(alias, "."):
+			c.skip = "not a valid destination name"
+		case exists:
+			c.skip = "already a destination"
+		default:
+			c.dest = destinationFromSSHConfig(alias, cfg.Resolve(alias))
+			importing[alias] = true
+		}
+		candidates = append(candidates, c)
+	}
+	if len(candidates) == 0 {
+		fmt.Println("No hosts found.")
+		return
+	}
+
+	previewImports(candidates)
+	warnUnknownJumps(candidates, importing)
+
+	if *dryRun {
+		fmt.Println("\nDry run; nothing was imported.")
+		return
+	}
+
+	saveImports(candidates)
+}
+
+// previewImports prints the destinations about to be imported, and the
+// reasons the others will not be.
+func previewImports(candidates []importCandidate) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tADDRESS\tAUTH\tJUMP\tSTATUS")
+	for _, c := range candidates {
+		if c.dest == nil {
+			fmt.Fprintf(tw, "%s\t\t\t\tskipped: %s\n", c.name, c.skip)
+			continue
+		}
+		d := c.dest
+		auth := "password"
+		if d.Auth == store.AuthKey {
+			auth = "key " + d.IdentityFile
+		}
+		fmt.Fprintf(tw, "%s\t%s@%s:%s\t%s\t%s\tnew\n", c.name, d.User, d.Host, d.Port, auth, d.ProxyJump)
+	}
+	tw.Flush()
+}
+
+// warnUnknownJumps warns about jump hosts that are neither destinations
+// nor being imported.
+func warnUnknownJumps(candidates []importCandidate, importing map[string]bool) {
+	for _, c := range candidates {
+		if c.dest == nil {
+			continue
+		}
+		for _, hop := range jumpHosts(c.dest.ProxyJump) {
+			if importing[hop] {
+				continue
+			}
+			if exists, _ := store.DestinationExists(hop); !exists {
+				fmt.Fprintf(os.Stderr, "Warning: %s jumps through %q, which is not a destination; add it under that name to connect.\n", c.name, hop)
+			}
+		}
+	}
+}
+
+// saveImports saves the candidates that are not skipped, asking for the
+// password of each that logs in with one.
+func saveImports(candidates []importCandidate) {
+	fmt.Println()
+	// Hosts with an identity file need nothing from the vault.
+	var masterPass string
+	for _, c := range candidates {
+		if c.dest != nil && c.dest.Auth == store.AuthPassword {
+			masterPass = verifyMasterPassword()
+			break
+		}
+	}
+	imported := 0
+	for _, c := range candidates {
+		if c.dest == nil {
+			continue
+		}
+		d := c.dest
+		if d.Auth == store.AuthPassword {
+			fmt.Printf("Password for %s (%s@%s, empty to skip): ", c.name, d.User, d.Host)
+			pass, err := readPassword()
+			fmt.Println()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+				os.Exit(1)
+			}
+			if pass == "" {
+				fmt.Printf("Skipped %s.\n", c.name)
+				continue
+			}
+			if err := encryptPassword(masterPass, []byte(pass), d); err != nil {
+				fmt.Fprintf(os.Stderr, "Error encrypting password: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := store.SaveDestination(c.name, d); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		auditChange(c.name)
+		imported++
+	}
+	if imported > 0 {
+		destinationsChanged(fmt.Sprintf("Import %d destination(s)", imported))
+	}
+	fmt.Printf("Imported %d destination(s).\n", imported)
+}
+
+// destinationFromSSHConfig builds a destination from the options ssh would
+// use for alias. Hosts with an IdentityFile log in with it; the rest need
+// a password.
+func destinationFromSSHConfig(alias string, opts map[string]string) *store.Destination {
+	d := &store.Destination{
+		Host: alias,
+		Port: "22",
+		User: localUser(),
+	}
+	if v := opts["hostname"]; v != "" {
+		d.Host = sshconfig.ExpandTokens(v, map[byte]string{'h': alias})
+	}
+	if v := opts["port"]; v != "" {
+		d.Port = v
+	}
+	if v := opts["user"]; v != "" {
+		d.User = v
+	}
+	if v := opts["proxyjump"]; v != "" && !strings.EqualFold(v, "none") {
+		d.ProxyJump = strings.Join(jumpHosts(v), ",")
+	}
+	if v := opts["identityfile"]; v != "" && !strings.EqualFold(v, "none") {
+		home, _ := os.UserHomeDir()
+		d.Auth = store.AuthKey
+		d.IdentityFile = sshconfig.ExpandTokens(v, map[byte]string{
+			'd': home,
+			'h': d.Host,
+			'n': alias,
+			'p': d.Port,
+			'r': d.User,
+			'u': localUser(),
+		})
+	}
+	return d
+}
@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"tele/internal/pwimport"
+	"tele/internal/store"
+	"tele/internal/totp"
+)
+
+// Reasons an entry of a password manager export is not imported.
+const (
+	skipFolder   = "outside the selected folder"
+	skipAddress  = "without an SSH address"
+	skipUser     = "without a username"
+	skipBadUser  = "with an invalid username"
+	skipPort     = "with an invalid port"
+	skipPassword = "without a password"
+	skipExists   = "already a destination"
+	skipName     = "with a name already taken in the export"
+)
+
+// passwordCandidate is an export entry about to be imported as a
+// destination, or the reason it will not be.
+type passwordCandidate struct {
+	entry pwimport.Entry
+	name  string
+	dest  *store.Destination
+	skip  string
+}
+
+func runImportPasswords(source string, args []string) {
+	fs := flag.NewFlagSet("import "+source, flag.ExitOnError)
+	var folder string
+	fs.StringVar(&folder, "folder", "", "import only entries in this folder or group and its subfolders")
+	fs.StringVar(&folder, "group", "", "same as --folder")
+	dryRun := fs.Bool("dry-run", false, "show what would be imported without saving anything")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: tele import %s [--folder <name>] [--dry-run] <file>\n", source)
+		os.Exit(1)
+	}
+	path := positional[0]
+
+	requireInit()
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var parse func(io.Reader) ([]pwimport.Entry, error)
+	switch source {
+	case "keepass":
+		parse = pwimport.ParseKeePass
+	case "bitwarden":
+		parse = pwimport.ParseBitwarden
+	default:
+		parse = pwimport.ParseCSV
+	}
+	entries, err := parse(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		os.Exit(1)
+	}
+
+	candidates, err := passwordCandidates(entries, folder, store.DestinationExists)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tADDRESS\tFOLDER\tTOTP\tSTATUS")
+	importing := 0
+	for _, c := range candidates {
+		if c.skip != "" {
+			continue
+		}
+		importing++
+		d := c.dest
+		otp := ""
+		if c.entry.TOTP != "" {
+			otp = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s@%s:%s\t%s\t%s\tnew\n", c.name, d.User, d.Host, d.Port, c.entry.Folder, otp)
+	}
+	if importing > 0 {
+		tw.Flush()
+	} else {
+		fmt.Println("No entries to import.")
+	}
+	printSkipped(candidates)
+
+	if *dryRun {
+		fmt.Println("\nDry run; nothing was imported.")
+		return
+	}
+	if importing == 0 {
+		return
+	}
+
+	fmt.Println()
+	masterPass := verifyMasterPassword()
+	imported := 0
+	for _, c := range candidates {
+		if c.skip != "" {
+			continue
+		}
+		d := c.dest
+		if err := encryptPassword(masterPass, []byte(c.entry.Password), d); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encrypting password: %v\n", err)
+			os.Exit(1)
+		}
+		if c.entry.TOTP != "" {
+			if _, err := totp.Parse(c.entry.TOTP); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s: ignoring its TOTP secret: %v\n", c.name, err)
+			} else if d.TOTP, err = encryptDestinationSecret(masterPass, d, []byte(strings.TrimSpace(c.entry.TOTP))); err != nil {
+				fmt.Fprintf(os.Stderr, "Error encrypting TOTP secret: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := store.SaveDestination(c.name, d); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		auditChange(c.name)
+		imported++
+	}
+	destinationsChanged(fmt.Sprintf("Import %d destination(s) from %s", imported, source))
+	fmt.Printf("Imported %d destination(s).\n", imported)
+	fmt.Printf("%s holds the passwords in plain text; delete it once you no longer need it.\n", path)
+}
+
+// passwordCandidates decides which entries to import and under what name.
+// exists reports whether a destination of that name is already saved.
+func passwordCandidates(entries []pwimport.Entry, folder string, exists func(name string) (bool, error)) ([]passwordCandidate, error) {
+	candidates := make([]passwordCandidate, 0, len(entries))
+	taken := map[string]bool{}
+	for _, e := range entries {
+		c := passwordCandidate{entry: e}
+		if folder != "" && !e.InFolder(folder) {
+			c.skip = skipFolder
+		} else {
+			c.name, c.dest, c.skip = destinationFromEntry(e)
+		}
+		if c.skip == "" {
+			saved, err := exists(c.name)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case saved:
+				c.skip = skipExists
+			case taken[c.name]:
+				c.skip = skipName
+			default:
+				taken[c.name] = true
+			}
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// printSkipped summarizes the entries that are not imported, by reason.
+func printSkipped(candidates []passwordCandidate) {
+	byReason := map[string][]string{}
+	total := 0
+	for _, c := range candidates {
+		if c.skip == "" {
+			continue
+		}
+		title := c.entry.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		byReason[c.skip] = append(byReason[c.skip], title)
+		total++
+	}
+	if total == 0 {
+		return
+	}
+	fmt.Printf("\nSkipped %d %s:\n", total, plural(total, "entry", "entries"))
+	reasons := make([]string, 0, len(byReason))
+	for r := range byReason {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	sort.SliceStable(reasons, func(i, j int) bool { return len(byReason[reasons[i]]) > len(byReason[reasons[j]]) })
+	for _, r := range reasons {
+		titles := byReason[r]
+		examples := titles
+		if len(examples) > 3 {
+			examples = examples[:3]
+		}
+		more := ""
+		if len(titles) > len(examples) {
+			more = ", ..."
+		}
+		fmt.Printf("  %4d %s (%s%s)\n", len(titles), r, strings.Join(examples, ", "), more)
+	}
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// destinationFromEntry builds a password destination from an export entry.
+// The address comes from a host custom field if there is one, otherwise
+// from the first ssh:// (or sftp:// or scp://) URL. It returns the reason to skip
+// the entry if it cannot be imported.
+func destinationFromEntry(e pwimport.Entry) (name string, d *store.Destination, skip string) {
+	var addr pwimport.Address
+	found := false
+	if h := e.Field("host", "hostname", "server"); h != "" {
+		if a, err := pwimport.ParseAddress(h); err == nil {
+			addr, found = a, true
+		}
+	}
+	for _, u := range e.URLs {
+		if found {
+			break
+		}
+		// A bare domain in a URL field is a website, not an SSH host.
+		if !strings.Contains(u, "://") {
+			continue
+		}
+		if a, err := pwimport.ParseAddress(u); err == nil {
+			addr, found = a, true
+		}
+	}
+	if !found {
+		return "", nil, skipAddress
+	}
+
+	d = &store.Destination{Host: addr.Host, Port: addr.Port, User: addr.User}
+	if d.Port == "" {
+		d.Port = e.Field("port")
+	}
+	if d.Port == "" {
+		d.Port = "22"
+	}
+	if pwimport.CheckPort(d.Port) != nil {
+		return "", nil, skipPort
+	}
+	if d.User == "" {
+		d.User = strings.TrimSpace(e.Username)
+	}
+	if d.User == "" {
+		return "", nil, skipUser
+	}
+	if pwimport.CheckUser(d.User) != nil {
+		return "", nil, skipBadUser
+	}
+	if e.Password == "" {
+		return "", nil, skipPassword
+	}
+
+	name = destinationName(e.Title)
+	if name == "" {
+		name = d.Host
+	}
+	return name, d, ""
+}
+
+// destinationName turns an entry title into a destination name: spaces
+// become dashes, and path separators and leading dots are dropped.
+func destinationName(title string) string {
+	name := strings.Join(strings.Fields(title), "-")
+	name = strings.NewReplacer("/", "", "\\", "", "\"", "", "#", "", "*", "", "?", "", "!", "").Replace(name)
+	return strings.TrimLeft(name, ".")
+}
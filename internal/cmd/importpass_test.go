@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"tele/internal/pwimport"
+	"tele/internal/store"
+)
+
+func TestDestinationFromEntry(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		entry pwimport.Entry
+		name  string
+		dest  store.Destination
+		skip  string
+	}{
+		{
+			desc:  "ssh URL",
+			entry: pwimport.Entry{Title: "web 1", URLs: []string{"ssh://root@10.0.0.5:2222"}, Username: "admin", Password: "pw"},
+			name:  "web-1",
+			dest:  store.Destination{Host: "10.0.0.5", Port: "2222", User: "root"},
+		},
+		{
+			desc: "host field before URLs",
+			entry: pwimport.Entry{
+				Title: "db", URLs: []string{"ssh://other.example.com"}, Username: "postgres", Password: "pw",
+				Fields: map[string]string{"hostname": "db1.example.com", "port": "2200"},
+			},
+			name: "db",
+			dest: store.Destination{Host: "db1.example.com", Port: "2200", User: "postgres"},
+		},
+		{
+			desc:  "untitled",
+			entry: pwimport.Entry{URLs: []string{"sftp://files.example.com"}, Username: "me", Password: "pw"},
+			name:  "files.example.com",
+			dest:  store.Destination{Host: "files.example.com", Port: "22", User: "me"},
+		},
+		{
+			desc:  "website",
+			entry: pwimport.Entry{Title: "wiki", URLs: []string{"https://wiki.example.com", "wiki.example.com"}, Username: "me", Password: "pw"},
+			skip:  skipAddress,
+		},
+		{
+			desc:  "no user",
+			entry: pwimport.Entry{Title: "box", URLs: []string{"ssh://box"}, Password: "pw"},
+			skip:  skipUser,
+		},
+		{
+			desc: "port field with a newline",
+			entry: pwimport.Entry{
+				Title: "box", URLs: []string{"ssh://box"}, Username: "me", Password: "pw",
+				Fields: map[string]string{"port": "22\nProxyCommand sh -c id"},
+			},
+			skip: skipPort,
+		},
+		{
+			desc:  "port field out of range",
+			entry: pwimport.Entry{Title: "box", URLs: []string{"ssh://box"}, Username: "me", Password: "pw", Fields: map[string]string{"port": "70000"}},
+			skip:  skipPort,
+		},
+		{
+			desc:  "username with a newline",
+			entry: pwimport.Entry{Title: "box", URLs: []string{"ssh://box"}, Username: "root\nHost *", Password: "pw"},
+			skip:  skipBadUser,
+		},
+		{
+			desc:  "username with a space",
+			entry: pwimport.Entry{Title: "box", URLs: []string{"ssh://box"}, Username: "john smith", Password: "pw"},
+			skip:  skipBadUser,
+		},
+		{
+			desc:  "no password",
+			entry: pwimport.Entry{Title: "box", URLs: []string{"ssh://me@box"}},
+			skip:  skipPassword,
+		},
+	} {
+		name, d, skip := destinationFromEntry(tc.entry)
+		if skip != tc.skip {
+			t.Errorf("%s: skip = %q, want %q", tc.desc, skip, tc.skip)
+			continue
+		}
+		if skip != "" {
+			continue
+		}
+		if name != tc.name || !reflect.DeepEqual(*d, tc.dest) {
+			t.Errorf("%s: got %q %+v, want %q %+v", tc.desc, name, *d, tc.name, tc.dest)
+		}
+	}
+}
+
+func TestDestinationName(t *testing.T) {
+	for title, want := range map[string]string{
+		"prod":           "prod",
+		"  web  server ": "web-server",
+		"Servers/db #1":  "Serversdb-1",
+		"..hidden":       "hidden",
+		`a\b"c*d?e!`:     "abcde",
+		"/":              "",
+	} {
+		if got := destinationName(title); got != want {
+			t.Errorf("destinationName(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestPasswordCandidates(t *testing.T) {
+	entry := func(title, folder, url string) pwimport.Entry {
+		return pwimport.Entry{Title: title, Folder: folder, URLs: []string{url}, Username: "me", Password: "pw"}
+	}
+	entries := []pwimport.Entry{
+		entry("web", "Servers", "ssh://web1"),
+		entry("web", "Servers/Prod", "ssh://web2"),
+		entry("db", "Servers", "ssh://db"),
+		entry("mail", "Personal", "ssh://mail"),
+		entry("cache", "Servers", "https://cache"),
+	}
+	saved := map[string]bool{"db": true}
+	candidates, err := passwordCandidates(entries, "servers", func(name string) (bool, error) {
+		return saved[name], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", skipName, skipExists, skipFolder, skipAddress}
+	if len(candidates) != len(want) {
+		t.Fatalf("got %d candidates, want %d", len(candidates), len(want))
+	}
+	for i, c := range candidates {
+		if c.skip != want[i] {
+			t.Errorf("%s in %s: skip = %q, want %q", c.entry.Title, c.entry.Folder, c.skip, want[i])
+		}
+	}
+	if candidates[0].name != "web" || candidates[0].dest.Host != "web1" {
+		t.Errorf("first entry imported as %q to %s", candidates[0].name, candidates[0].dest.Host)
+	}
+}
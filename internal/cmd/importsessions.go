@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"tele/internal/sessions"
+	"tele/internal/store"
+)
+
+func runImportSessions(source string, args []string) {
+	fs := flag.NewFlagSet("import "+source, flag.ExitOnError)
+	folder := fs.String("folder", "", "import only sessions in this folder and its subfolders")
+	dryRun := fs.Bool("dry-run", false, "show what would be imported without saving anything")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: tele import %s [--folder <name>] [--dry-run] <file>\n", source)
+		os.Exit(1)
+	}
+	path := positional[0]
+
+	requireInit()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var found []sessions.Session
+	if source == "putty" {
+		found, err = sessions.ParsePuTTY(data)
+	} else {
+		found, err = sessions.ParseMobaXterm(data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	if *folder != "" {
+		f := strings.ToLower(strings.Trim(*folder, "/"))
+		var in []sessions.Session
+		for _, s := range found {
+			g := strings.ToLower(s.Folder)
+			if g == f || strings.HasPrefix(g, f+"/") {
+				in = append(in, s)
+			}
+		}
+		found = in
+	}
+	if len(found) == 0 {
+		fmt.Println("No SSH sessions found.")
+		return
+	}
+
+	existing, err := loadAllDestinations()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	im := &sessionImport{existing: existing, taken: map[string]bool{}}
+	for name := range existing {
+		im.taken[name] = true
+	}
+	for _, s := range found {
+		im.add(s)
+	}
+	im.resolveJumps()
+
+	previewImports(im.candidates)
+	for i, s := range im.sessions {
+		c := im.candidates[i]
+		if c.dest == nil || c.dest.Auth != store.AuthKey {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(s.KeyFile), ".ppk") {
+			fmt.Fprintf(os.Stderr, "Warning: %s uses a PuTTY key; convert it with 'puttygen %s -O private-openssh -o <file>' and point the destination at it with 'tele edit %s'.\n", c.name, s.KeyFile, c.name)
+		} else if _, err := os.Stat(expandHome(c.dest.IdentityFile)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: key %s is not on this machine; copy it here or change it with 'tele edit %s'.\n", c.name, c.dest.IdentityFile, c.name)
+		}
+	}
+
+	if *dryRun {
+		fmt.Println("\nDry run; nothing was imported.")
+		return
+	}
+	n := 0
+	for _, c := range im.candidates {
+		if c.dest != nil {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+	ok, err := promptYesNo(fmt.Sprintf("Import %d destination(s)?", n), true)
+	if err != nil || !ok {
+		fmt.Println("Nothing was imported.")
+		return
+	}
+	saveImports(im.candidates)
+}
+
+// sessionImport turns sessions of another client into import candidates.
+// candidates[i] is made from sessions[i], except for jump hosts added
+// after them.
+type sessionImport struct {
+	existing   map[string]*store.Destination
+	taken      map[string]bool
+	sessions   []sessions.Session
+	candidates []importCandidate
+}
+
+func (im *sessionImport) add(s sessions.Session) {
+	name := destinationName(s.Name)
+	if name == "" {
+		name = s.Host
+	}
+	c := importCandidate{name: name}
+	d := &store.Destination{Host: s.Host, Port: s.Port, User: s.User}
+	if d.Port == "" {
+		d.Port = "22"
+	}
+	if d.User == "" {
+		d.User = localUser()
+	}
+	if s.KeyFile != "" {
+		d.Auth = store.AuthKey
+		d.IdentityFile = s.KeyFile
+	}
+	switch {
+	case im.existing[name] != nil:
+		c.skip = skipExists
+	case im.taken[name]:
+		c.skip = "name already taken by another session"
+	default:
+		if dup := im.sameAddress(d); dup != "" {
+			c.skip = fmt.Sprintf("same address as destination %q", dup)
+		} else {
+			c.dest = d
+			im.taken[name] = true
+		}
+	}
+	im.sessions = append(im.sessions, s)
+	im.candidates = append(im.candidates, c)
+}
+
+// resolveJumps sets the jump host of each imported session. It runs once
+// every session has its name, so that a jump host can be another session.
+func (im *sessionImport) resolveJumps() {
+	for i, s := range im.sessions {
+		if c := &im.candidates[i]; c.dest != nil && s.Jump != nil {
+			c.dest.ProxyJump = im.jumpName(s.Jump)
+		}
+	}
+}
+
+// sameAddress returns the existing destination that logs in to the same
+// user, host and port as d, if any.
+func (im *sessionImport) sameAddress(d *store.Destination) string {
+	for name, e := range im.existing {
+		if strings.EqualFold(e.Host, d.Host) && e.Port == d.Port && e.User == d.User {
+			return name
+		}
+	}
+	return ""
+}
+
+// jumpName returns the destination to use as a jump host: an imported
+// session or an existing destination at its address, or else a new
+// destination added for it.
+func (im *sessionImport) jumpName(j *sessions.Jump) string {
+	port := j.Port
+	if port == "" {
+		port = "22"
+	}
+	matches := func(d *store.Destination) bool {
+		return strings.EqualFold(d.Host, j.Host) && d.Port == port && (j.User == "" || d.User == j.User)
+	}
+	for _, c := range im.candidates {
+		if c.dest != nil && matches(c.dest) {
+			return c.name
+		}
+	}
+	for name, d := range im.existing {
+		if matches(d) {
+			return name
+		}
+	}
+	user := j.User
+	if user == "" {
+		user = localUser()
+	}
+	name := destinationName(j.Host)
+	for i := 2; im.taken[name]; i++ {
+		name = fmt.Sprintf("%s-%d", destinationName(j.Host), i)
+	}
+	im.taken[name] = true
+	im.candidates = append(im.candidates, importCandidate{
+		name: name,
+		dest: &store.Destination{Host: j.Host, Port: port, User: user},
+	})
+	return name
+}
+
+// loadAllDestinations loads every destination, by name.
+func loadAllDestinations() (map[string]*store.Destination, error) {
+	names, err := store.ListDestinations()
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]*store.Destination, len(names))
+	for _, name := range names {
+		d, err := store.LoadDestination(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		all[name] = d
+	}
+	return all, nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"testing"
+
+	"tele/internal/sessions"
+	"tele/internal/store"
+)
+
+func TestSessionImport(t *testing.T) {
+	existing := map[string]*store.Destination{
+		"old":     {Host: "10.0.0.9", Port: "22", User: "root"},
+		"bastion": {Host: "198.51.100.1", Port: "22", User: "ops"},
+	}
+	im := &sessionImport{existing: existing, taken: map[string]bool{"old": true, "bastion": true}}
+	for _, s := range []sessions.Session{
+		{Name: "web", Host: "10.0.0.1", User: "deploy", Jump: &sessions.Jump{Host: "203.0.113.10", User: "ops"}},
+		{Name: "web", Host: "10.0.0.2", User: "deploy"},
+		{Name: "gw", Host: "203.0.113.10", Port: "22", User: "ops"},
+		{Name: "old copy", Host: "10.0.0.9", Port: "22", User: "root"},
+		{Name: "bastion", Host: "bastion.example.com", User: "ops"},
+		{Name: "db", Host: "10.0.0.3", User: "u", Jump: &sessions.Jump{Host: "198.51.100.1", Port: "22", User: "ops"}},
+		{Name: "cache", Host: "10.0.0.4", User: "u", Jump: &sessions.Jump{Host: "192.0.2.7", User: "admin"}},
+		{Name: "192.0.2.8", Host: "192.0.2.8", User: "u"},
+		{Name: "app", Host: "10.0.0.5", User: "u", Jump: &sessions.Jump{Host: "192.0.2.8", User: "admin"}},
+	} {
+		im.add(s)
+	}
+	im.resolveJumps()
+
+	for i, want := range []struct {
+		name, skip, jump string
+	}{
+		// A jump host that is also a session resolves to that session.
+		{"web", "", "gw"},
+		{"web", "name already taken by another session", ""},
+		{"gw", "", ""},
+		{"old-copy", `same address as destination "old"`, ""},
+		{"bastion", skipExists, ""},
+		{"db", "", "bastion"},
+		{"cache", "", "192.0.2.7"},
+		{"192.0.2.8", "", ""},
+		// The session at the jump host's address logs in as someone else.
+		{"app", "", "192.0.2.8-2"},
+		// Jump hosts with no destination yet are added after the sessions.
+		{"192.0.2.7", "", ""},
+		{"192.0.2.8-2", "", ""},
+	} {
+		if i >= len(im.candidates) {
+			t.Fatalf("got %d candidates, want more", len(im.candidates))
+		}
+		c := im.candidates[i]
+		jump := ""
+		if c.dest != nil {
+			jump = c.dest.ProxyJump
+		}
+		if c.name != want.name || c.skip != want.skip || jump != want.jump {
+			t.Errorf("candidate %d = %q (skip %q, jump %q), want %q (skip %q, jump %q)", i, c.name, c.skip, jump, want.name, want.skip, want.jump)
+		}
+		if (c.skip == "") != (c.dest != nil) {
+			t.Errorf("candidate %d: skip %q with destination %v", i, c.skip, c.dest)
+		}
+	}
+	if len(im.candidates) != 11 {
+		t.Errorf("got %d candidates, want 11", len(im.candidates))
+	}
+	if d := im.candidates[9].dest; d.Port != "22" || d.User != "admin" {
+		t.Errorf("added jump host %+v, want port 22 and user admin", d)
+	}
+}
@@ -45,6 +45,16 @@ func RunInit() {
 		os.Exit(1)
 	}
 
+	withCode, err := promptYesNo("Create a recovery code in case you forget the master password?", true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if withCode {
+		initWithRecoveryCode(password)
+		return
+	}
+
 	salt, err := crypto.GenerateSalt()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating salt: %v\n", err)
@@ -58,5 +68,30 @@ func RunInit() {
 		os.Exit(1)
 	}
 
+	auditMaster("master password set")
+	fmt.Println("Master password set successfully.")
+}
+
+// initWithRecoveryCode sets up a vault whose secrets are encrypted under a
+// vault key, wrapped both under password and under a recovery code.
+func initWithRecoveryCode(password string) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating vault key: %v\n", err)
+		os.Exit(1)
+	}
+	code, recovery, err := newRecoveryCode(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	mc := &store.MasterConfig{Recovery: recovery}
+	if err := setMasterPassword(mc, password, key); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing master config: %v\n", err)
+		os.Exit(1)
+	}
+
+	auditMaster("master password set, with a recovery code")
 	fmt.Println("Master password set successfully.")
+	printRecoveryCode(code)
 }
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"tele/internal/mux"
+	"tele/internal/remote"
+	"tele/internal/store"
+)
+
+// maxJumps bounds a chain of jump hosts, which also catches loops.
+const maxJumps = 8
+
+// jumpHosts splits a ProxyJump value into the destination names it lists,
+// nearest to the client first.
+func jumpHosts(proxyJump string) []string {
+	var hosts []string
+	for _, h := range strings.Split(proxyJump, ",") {
+		if h = strings.TrimSpace(h); h != "" && h != "none" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// resolveJump decrypts the credentials for the jump hosts listed in
+// proxyJump and returns the last one, through which the destination itself
+// is reached. The first host is reached through its own jump hosts, if any,
+// and each later one through the host before it, as with ssh -J.
+func resolveJump(masterPass, proxyJump string, depth int) (*remote.Hop, error) {
+	var prev *remote.Hop
+	for i, name := range jumpHosts(proxyJump) {
+		if depth+i >= maxJumps {
+			return nil, fmt.Errorf("more than %d jump hosts; is there a ProxyJump loop?", maxJumps)
+		}
+		exists, err := store.DestinationExists(name)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("jump host %q is not a destination; add it with 'tele add %s'", name, name)
+		}
+		d, err := store.LoadDestination(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		creds, err := decryptLogin(masterPass, d)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting %s: %w", name, err)
+		}
+		auditDecrypt(name)
+		if i == 0 {
+			creds.Jump, err = resolveJump(masterPass, d.ProxyJump, depth+1)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			creds.Jump = prev
+		}
+		prev = &remote.Hop{Name: name, Dest: d, Creds: creds}
+	}
+	return prev, nil
+}
+
+// dialJump connects to the jump host d is reached through, or returns nil
+// if it is reached directly. Without decrypted credentials for the jump
+// host only its shared connection can be used.
+func dialJump(d *store.Destination, creds remote.Credentials, timeout time.Duration) (*ssh.Client, error) {
+	if creds.Jump != nil {
+		hop := creds.Jump
+		client, err := dialDestination(hop.Name, hop.Dest, hop.Creds, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("jump host %s: %w", hop.Name, err)
+		}
+		return client, nil
+	}
+	hosts := jumpHosts(d.ProxyJump)
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	nearest := hosts[len(hosts)-1]
+	client, err := mux.Dial(nearest)
+	if err != nil {
+		return nil, fmt.Errorf("reaching it through %s needs that host's credentials", nearest)
+	}
+	return client, nil
+}
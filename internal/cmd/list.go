@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"tele/internal/store"
 )
@@ -17,12 +18,20 @@ func RunList() {
 		fmt.Println("No destinations saved.")
 		return
 	}
+	health, err := store.ReadHealth()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading health cache: %v\n", err)
+	}
 	for _, name := range names {
 		host, port, user, _, _, _, err := store.ReadDestination(name)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", name, err)
 			continue
 		}
-		fmt.Printf("  %s → %s@%s:%s\n", name, user, host, port)
+		line := fmt.Sprintf("  %s → %s@%s:%s", name, user, host, port)
+		if h, ok := health[name]; ok {
+			line += fmt.Sprintf("  [%s, checked %s ago]", h.Status(), time.Since(h.Checked).Round(time.Minute))
+		}
+		fmt.Println(line)
 	}
 }
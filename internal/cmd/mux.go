@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"tele/internal/ca"
+	"tele/internal/mux"
+	"tele/internal/remote"
+	"tele/internal/store"
+)
+
+const (
+	defaultMuxIdle   = 10 * time.Minute
+	muxKeepalive     = 15 * time.Second
+	muxStartDeadline = 30 * time.Second
+)
+
+// masterRunning reports whether a destination has a live shared master.
+func masterRunning(name string) bool {
+	client, err := mux.Dial(name)
+	if err != nil {
+		return false
+	}
+	client.Close()
+	return true
+}
+
+// muxIdle returns the idle timeout of automatically started masters, or 0
+// if connection sharing is off.
+func muxIdle() time.Duration {
+	s, err := store.ReadSettings()
+	if err != nil || s.MuxIdle == "" {
+		return 0
+	}
+	idle, err := time.ParseDuration(s.MuxIdle)
+	if err != nil {
+		return 0
+	}
+	return idle
+}
+
+// startMaster starts a background master for name and waits until it is
+// connected. The credentials reach it over a pipe, never argv or the
+// environment.
+func startMaster(name string, creds remote.Credentials, idle time.Duration) error {
+	if hop := creds.Jump; hop != nil && !masterRunning(hop.Name) {
+		// The master reaches its destination through the jump host's own
+		// master, which needs the jump host's credentials.
+		if err := startMaster(hop.Name, hop.Creds, idle); err != nil {
+			return err
+		}
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	c := exec.Command(self, "mux", "serve", "--idle", idle.String(), name)
+	c.Stderr = os.Stderr
+	// A session of its own keeps the master out of the terminal's job
+	// control, so it survives the command that started it.
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := c.Start(); err != nil {
+		return fmt.Errorf("starting master for %s: %w", name, err)
+	}
+	payload, err := newMasterCredentials(creds)
+	if err == nil {
+		err = json.NewEncoder(stdin).Encode(payload)
+	}
+	stdin.Close()
+	if err != nil {
+		c.Process.Kill()
+		c.Wait()
+		return err
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(stdout).ReadString('\n')
+		result <- strings.TrimSpace(line)
+	}()
+	select {
+	case line := <-result:
+		if line != "ready" {
+			c.Wait()
+			return fmt.Errorf("starting master for %s: %s", name, strings.TrimPrefix(line, "error: "))
+		}
+	case <-time.After(muxStartDeadline):
+		c.Process.Kill()
+		c.Wait()
+		return fmt.Errorf("starting master for %s: timed out", name)
+	}
+	return c.Process.Release()
+}
+
+// masterCredentials is how credentials travel to a master process. A
+// certificate destination sends one certificate issued for the login
+// rather than the means to issue more, and a destination behind a jump
+// host only the name of the jump host, whose master it goes through.
+type masterCredentials struct {
+	remote.Credentials
+	CertKey  []byte `json:"cert_key,omitempty"`
+	Cert     []byte `json:"cert,omitempty"`
+	Identity []byte `json:"identity,omitempty"`
+	Jump     string `json:"jump,omitempty"`
+}
+
+func newMasterCredentials(creds remote.Credentials) (*masterCredentials, error) {
+	mc := &masterCredentials{Credentials: creds}
+	if creds.Certificate != nil {
+		issued, err := creds.Certificate()
+		if err != nil {
+			return nil, err
+		}
+		if mc.CertKey, err = issued.MarshalKey(""); err != nil {
+			return nil, err
+		}
+		mc.Cert = ssh.MarshalAuthorizedKey(issued.Cert)
+	}
+	if creds.Identity != nil {
+		block, err := ssh.MarshalPrivateKey(creds.Identity, "")
+		if err != nil {
+			return nil, err
+		}
+		mc.Identity = pem.EncodeToMemory(block)
+	}
+	if creds.Jump != nil {
+		mc.Jump = creds.Jump.Name
+	}
+	return mc, nil
+}
+
+func (mc *masterCredentials) credentials() (remote.Credentials, error) {
+	creds := mc.Credentials
+	if mc.Cert != nil {
+		issued, err := ca.ParseIssued(mc.CertKey, mc.Cert)
+		if err != nil {
+			return creds, err
+		}
+		creds.Certificate = func() (*ca.Issued, error) { return issued, nil }
+	}
+	if mc.Identity != nil {
+		key, err := ssh.ParseRawPrivateKey(mc.Identity)
+		if err != nil {
+			return creds, err
+		}
+		creds.Identity = key
+	}
+	if mc.Jump != "" {
+		d, err := store.LoadDestination(mc.Jump)
+		if err != nil {
+			return creds, err
+		}
+		creds.Jump = &remote.Hop{Name: mc.Jump, Dest: d}
+	}
+	return creds, nil
+}
+
+func RunMux(args []string) {
+	usage := "Usage: tele mux start [--idle D] <name> | stop [--all] [name...] | status | auto <duration|off>"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "start":
+		runMuxStart(args[1:])
+	case "stop":
+		runMuxStop(args[1:])
+	case "status":
+		runMuxStatus()
+	case "auto":
+		runMuxAuto(args[1:])
+	case "serve":
+		runMuxServe(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+func runMuxStart(args []string) {
+	fs := flag.NewFlagSet("mux start", flag.ExitOnError)
+	idle := fs.Duration("idle", defaultMuxIdle, "exit after this long without use")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele mux start [--idle D] <name>")
+		os.Exit(1)
+	}
+	name := positional[0]
+
+	requireInit()
+	destExists, err := store.DestinationExists(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !destExists {
+		fmt.Fprintf(os.Stderr, "Destination %q not found.\n", name)
+		os.Exit(1)
+	}
+	if masterRunning(name) {
+		fmt.Printf("A shared connection to %q is already running.\n", name)
+		return
+	}
+
+	masterPass := verifyMasterPassword()
+	d, err := store.LoadDestination(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading destination: %v\n", err)
+		os.Exit(1)
+	}
+	creds, err := decryptCredentials(masterPass, d)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error decrypting password: %v\n", err)
+		os.Exit(1)
+	}
+	auditDecrypt(name)
+	if err := startMaster(name, creds, *idle); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Sharing a connection to %q until it is idle for %s.\n", name, *idle)
+}
+
+func runMuxStop(args []string) {
+	fs := flag.NewFlagSet("mux stop", flag.ExitOnError)
+	all := fs.Bool("all", false, "stop every shared connection")
+	names := parseInterspersed(fs, args)
+	if *all {
+		var err error
+		if names, err = mux.Running(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: tele mux stop [--all] [name...]")
+		os.Exit(1)
+	}
+	failed := false
+	for _, name := range names {
+		if err := mux.Stop(name); err != nil {
+			fmt.Fprintf(os.Stderr, "No shared connection to %q is running.\n", name)
+			failed = true
+			continue
+		}
+		fmt.Printf("Stopped shared connection to %q.\n", name)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runMuxStatus() {
+	names, err := mux.Running()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if idle := muxIdle(); idle > 0 {
+		fmt.Printf("Connections are shared automatically (idle timeout %s).\n", idle)
+	} else {
+		fmt.Println("Connections are only shared when started with 'tele mux start'.")
+	}
+	if len(names) == 0 {
+		fmt.Println("No shared connections are running.")
+		return
+	}
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tADDRESS\tPID\tUP\tCHANNELS\tIDLE")
+	for _, name := range names {
+		s, err := mux.QueryStatus(name)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t(%v)\n", name, err)
+			continue
+		}
+		idle := "-"
+		if s.Channels == 0 {
+			idle = s.Idle.Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%s\n", s.Name, s.Addr, s.PID,
+			time.Since(s.Started).Round(time.Second), s.Channels, idle)
+	}
+	tw.Flush()
+}
+
+func runMuxAuto(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele mux auto <duration|off>")
+		os.Exit(1)
+	}
+	requireInit()
+	s, err := store.ReadSettings()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading settings: %v\n", err)
+		os.Exit(1)
+	}
+	if args[0] == "off" {
+		s.MuxIdle = ""
+	} else {
+		idle, err := time.ParseDuration(args[0])
+		if err != nil || idle <= 0 {
+			fmt.Fprintln(os.Stderr, "Give an idle timeout such as 10m, or off.")
+			os.Exit(1)
+		}
+		s.MuxIdle = idle.String()
+	}
+	if err := store.WriteSettings(s); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving settings: %v\n", err)
+		os.Exit(1)
+	}
+	if s.MuxIdle == "" {
+		fmt.Println("Automatic connection sharing turned off.")
+	} else {
+		fmt.Printf("Connections will be shared automatically and kept for %s after last use.\n", s.MuxIdle)
+	}
+}
+
+// runMuxServe is the master process started by startMaster. It reads the
+// credentials from stdin, connects, reports "ready" or an error on stdout
+// and then serves clients with its output detached.
+func runMuxServe(args []string) {
+	fs := flag.NewFlagSet("mux serve", flag.ExitOnError)
+	idle := fs.Duration("idle", defaultMuxIdle, "exit after this long without use")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		os.Exit(2)
+	}
+	name := positional[0]
+
+	fail := func(err error) {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	var payload masterCredentials
+	if err := json.NewDecoder(os.Stdin).Decode(&payload); err != nil {
+		fail(fmt.Errorf("reading credentials: %w", err))
+	}
+	creds, err := payload.credentials()
+	if err != nil {
+		fail(fmt.Errorf("reading credentials: %w", err))
+	}
+	d, err := store.LoadDestination(name)
+	if err != nil {
+		fail(err)
+	}
+	upstream, err := dialDirect(name, d, creds, remote.DefaultTimeout)
+	if err != nil {
+		fail(err)
+	}
+	m := mux.NewMaster(name, upstream, *idle)
+	l, err := m.Listen()
+	if err != nil {
+		upstream.Close()
+		fail(err)
+	}
+	remote.KeepAlive(upstream, muxKeepalive, keepaliveMaxMiss)
+
+	fmt.Println("ready")
+	detachOutput()
+	m.Serve(l)
+}
+
+// detachOutput points stdout and stderr at /dev/null once the process that
+// started the master has stopped listening.
+func detachOutput() {
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = null, null
+	stdout.Close()
+	stderr.Close()
+}
@@ -49,8 +49,21 @@ func promptLine(prompt, defaultVal string) (string, error) {
 }
 
 // verifyMasterPassword prompts for the master password and verifies it.
-// Returns the password string on success, or exits on failure.
+// Returns the secret the vault's keys derive from on success, or exits on
+// failure: the password itself, or the vault key once the vault has one.
 func verifyMasterPassword() string {
+	password, mc := readMasterPassword()
+	secret, err := vaultSecret(password, mc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error unlocking vault key: %v\n", err)
+		os.Exit(1)
+	}
+	return secret
+}
+
+// readMasterPassword prompts for the master password and verifies it,
+// returning it with the master config. Exits on failure.
+func readMasterPassword() (string, *store.MasterConfig) {
 	fmt.Print("Enter master password: ")
 	password, err := readPassword()
 	if err != nil {
@@ -59,7 +72,12 @@ func verifyMasterPassword() string {
 	}
 	fmt.Println()
 
-	salt, hash, err := store.ReadMaster()
+	mc, err := store.LoadMaster()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading master config: %v\n", err)
+		os.Exit(1)
+	}
+	salt, hash, err := decodeMaster(mc)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading master config: %v\n", err)
 		os.Exit(1)
@@ -69,6 +87,87 @@ func verifyMasterPassword() string {
 		fmt.Fprintln(os.Stderr, "Incorrect master password.")
 		os.Exit(1)
 	}
+	if mc.PendingVaultKey != nil {
+		fmt.Println("Finishing moving the vault's secrets under a vault key...")
+		if _, err := finishVaultKey(password, mc); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	return password, mc
+}
+
+// readNewMasterPassword prompts for a new master password twice.
+func readNewMasterPassword() (string, error) {
+	fmt.Print("Enter master password: ")
+	password, err := readPassword()
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	if len(password) < 1 {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+	fmt.Print("Confirm master password: ")
+	confirm, err := readPassword()
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	if password != confirm {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return password, nil
+}
+
+// lazyMasterPassword returns a func that prompts for the master password
+// the first time it is called, for commands that may not need it at all.
+func lazyMasterPassword() func() string {
+	var pass string
+	return func() string {
+		if pass == "" {
+			pass = verifyMasterPassword()
+		}
+		return pass
+	}
+}
+
+// requireInit exits unless a master password has been configured.
+func requireInit() {
+	exists, err := store.MasterExists()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !exists {
+		fmt.Fprintln(os.Stderr, "Not initialized. Run 'tele init' first.")
+		os.Exit(1)
+	}
+}
 
-	return password
+// promptRecordMode asks whether sessions to a destination are always recorded.
+func promptRecordMode(current string) (string, error) {
+	def := "no"
+	if current != store.RecordOff {
+		def = current
+		if def == store.RecordOn {
+			def = "yes"
+		}
+	}
+	for {
+		answer, err := promptLine("Record sessions (no/yes/encrypted)", def)
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToLower(answer) {
+		case "no", "n":
+			return store.RecordOff, nil
+		case "yes", "y", "on":
+			return store.RecordOn, nil
+		case "encrypted", "e":
+			return store.RecordEncrypted, nil
+		}
+		fmt.Println("Please answer no, yes or encrypted.")
+	}
 }
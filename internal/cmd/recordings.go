@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"tele/internal/config"
+	"tele/internal/crypto"
+	"tele/internal/record"
+)
+
+func RunRecordings(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: tele recordings list | play [--speed N] [--idle D] <id>")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "list":
+		listRecordings()
+	case "play":
+		playRecording(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown recordings command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// recordingPaths maps recording ids to their file paths.
+func recordingPaths() (map[string]string, error) {
+	dir, err := config.RecordingsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]string{}
+	for _, e := range entries {
+		name := e.Name()
+		id := strings.TrimSuffix(strings.TrimSuffix(name, record.EncryptedExt), ".cast")
+		if e.IsDir() || id == name {
+			continue
+		}
+		paths[id] = filepath.Join(dir, name)
+	}
+	return paths, nil
+}
+
+func listRecordings() {
+	paths, err := recordingPaths()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing recordings: %v\n", err)
+		os.Exit(1)
+	}
+	if len(paths) == 0 {
+		fmt.Println("No recordings.")
+		return
+	}
+	ids := make([]string, 0, len(paths))
+	for id := range paths {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		info, err := record.Stat(paths[id])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", id, err)
+			continue
+		}
+		duration := info.Duration.Round(time.Second).String()
+		if info.Encrypted {
+			duration = "encrypted"
+		}
+		fmt.Printf("  %s → %s, %s (%s)\n", id, info.Destination, info.Start.Local().Format("2006-01-02 15:04:05"), duration)
+	}
+}
+
+func playRecording(args []string) {
+	fs := flag.NewFlagSet("recordings play", flag.ExitOnError)
+	speed := fs.Float64("speed", 1, "playback speed multiplier")
+	idle := fs.Duration("idle", 2*time.Second, "cap pauses at this length (0 keeps them)")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele recordings play [--speed N] [--idle D] <id>")
+		os.Exit(1)
+	}
+	id := positional[0]
+
+	paths, err := recordingPaths()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	path, ok := paths[id]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Recording %q not found.\n", id)
+		os.Exit(1)
+	}
+
+	var masterPass string
+	if strings.HasSuffix(path, record.EncryptedExt) {
+		requireInit()
+		masterPass = verifyMasterPassword()
+	}
+	header, events, err := record.Load(path, func(salt []byte) []byte {
+		return crypto.DeriveKey(masterPass, salt)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading recording: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Playing %s (%dx%d). Press Ctrl-C to stop.\n", id, header.Width, header.Height)
+	if err := record.Play(os.Stdout, events, *speed, *idle); err != nil {
+		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("\nEnd of recording.")
+}
@@ -0,0 +1,541 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"tele/internal/config"
+	"tele/internal/crypto"
+	"tele/internal/record"
+	"tele/internal/shamir"
+	"tele/internal/store"
+)
+
+// shareVersion is the first byte of every printed recovery share.
+const shareVersion = 1
+
+func RunRecovery(args []string) {
+	usage := "Usage: tele recovery split [--shares N] [--threshold K] | combine | code"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+	requireInit()
+	switch {
+	case args[0] == "split":
+		runRecoverySplit(args[1:])
+	case args[0] == "combine" && len(args) == 1:
+		runRecoveryCombine()
+	case args[0] == "code" && len(args) == 1:
+		runRecoveryCode()
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+func runRecoverySplit(args []string) {
+	fs := flag.NewFlagSet("recovery split", flag.ExitOnError)
+	n := fs.Int("shares", 5, "number of shares to print")
+	threshold := fs.Int("threshold", 3, "number of shares needed to recover")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: tele recovery split [--shares N] [--threshold K]")
+		os.Exit(1)
+	}
+	if *threshold < 2 || *threshold > *n || *n > 255 {
+		fmt.Fprintln(os.Stderr, "The threshold must be at least 2 and at most the number of shares (up to 255).")
+		os.Exit(1)
+	}
+
+	password, mc := readMasterPassword()
+	var key []byte
+	var err error
+	if mc.VaultKey == nil {
+		fmt.Println("Moving the vault's secrets under a vault key that the shares can recover...")
+		key, err = enableVaultKey(password, mc)
+	} else {
+		key, err = decryptSecret(password, mc.VaultKey)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	shares, err := shamir.Split(key, *n, *threshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	auditMaster(fmt.Sprintf("made %d recovery shares, %d needed", *n, *threshold))
+	check, _ := hex.DecodeString(mc.VaultKeyCheck)
+	fmt.Printf("\nAny %d of these %d shares recover the vault and reset its master password.\n", *threshold, *n)
+	fmt.Println("Give each to a different person and keep them offline.")
+	for _, s := range shares {
+		fmt.Printf("\nShare %d of %d:\n  %s\n", s.X, *n, encodeShare(check, *threshold, s))
+	}
+	fmt.Println("\nShares from an earlier split stay valid; they recover the same vault key.")
+}
+
+func runRecoveryCombine() {
+	mc, err := store.LoadMaster()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading master config: %v\n", err)
+		os.Exit(1)
+	}
+	if mc.VaultKeyCheck == "" {
+		fmt.Fprintln(os.Stderr, "This vault has no recovery shares; 'tele recovery split' creates them.")
+		os.Exit(1)
+	}
+	check, err := hex.DecodeString(mc.VaultKeyCheck)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading master config: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Enter the recovery shares, one at a time.")
+	var shares []shamir.Share
+	threshold := 2
+	for len(shares) < threshold {
+		line, err := promptLine(fmt.Sprintf("Share %d", len(shares)+1), "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if line == "" {
+			continue
+		}
+		s, k, err := decodeShare(line, check)
+		if err != nil {
+			fmt.Printf("  %v\n", err)
+			continue
+		}
+		if slices.ContainsFunc(shares, func(o shamir.Share) bool { return o.X == s.X }) {
+			fmt.Printf("  Share %d was already entered.\n", s.X)
+			continue
+		}
+		shares = append(shares, s)
+		threshold = k
+		if len(shares) < threshold {
+			fmt.Printf("  Accepted; %d more needed.\n", threshold-len(shares))
+		}
+	}
+	key, err := shamir.Combine(shares)
+	if err == nil && !bytes.Equal(vaultKeyCheck(key), check) {
+		err = fmt.Errorf("the shares do not recover this vault's key")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Vault key recovered. Choose a new master password.")
+	password, err := readNewMasterPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := setMasterPassword(mc, password, key); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing master config: %v\n", err)
+		os.Exit(1)
+	}
+	auditMaster("master password reset with recovery shares")
+	syncCommit("Reset master password")
+	fmt.Println("Master password reset.")
+}
+
+func runRecoveryCode() {
+	password, mc := readMasterPassword()
+	var key []byte
+	var err error
+	if mc.VaultKey == nil {
+		fmt.Println("Moving the vault's secrets under a vault key that the code can recover...")
+		key, err = enableVaultKey(password, mc)
+	} else {
+		key, err = decryptSecret(password, mc.VaultKey)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	replacing := mc.Recovery != nil
+	code, recovery, err := newRecoveryCode(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	mc.Recovery = recovery
+	if err := store.SaveMaster(mc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing master config: %v\n", err)
+		os.Exit(1)
+	}
+	if replacing {
+		auditMaster("recovery code replaced")
+	} else {
+		auditMaster("recovery code created")
+	}
+	syncCommit("Replace recovery code")
+	printRecoveryCode(code)
+	if replacing {
+		fmt.Println("The previous recovery code no longer works.")
+	}
+}
+
+func RunRecover() {
+	requireInit()
+	mc, err := store.LoadMaster()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading master config: %v\n", err)
+		os.Exit(1)
+	}
+	if mc.Recovery == nil {
+		fmt.Fprintln(os.Stderr, "This vault has no recovery code. If recovery shares were made, use 'tele recovery combine'.")
+		os.Exit(1)
+	}
+
+	line, err := promptLine("Recovery code", "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	key, err := decryptSecret(normalizeRecoveryCode(line), mc.Recovery)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "That recovery code does not unlock this vault.")
+		os.Exit(1)
+	}
+
+	fmt.Println("Recovery code accepted. Choose a new master password.")
+	password, err := readNewMasterPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// The code works once: anyone who saw it while it was in use must not
+	// be able to reset the password again.
+	mc.Recovery = nil
+	if err := setMasterPassword(mc, password, key); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing master config: %v\n", err)
+		os.Exit(1)
+	}
+	auditMaster("master password reset with the recovery code")
+	syncCommit("Reset master password")
+	fmt.Println("Master password reset. The recovery code has been used up.")
+
+	again, err := promptYesNo("Create a new recovery code?", true)
+	if err != nil || !again {
+		return
+	}
+	code, recovery, err := newRecoveryCode(key)
+	if err == nil {
+		mc.Recovery = recovery
+		err = store.SaveMaster(mc)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	auditMaster("recovery code replaced")
+	syncCommit("Replace recovery code")
+	printRecoveryCode(code)
+}
+
+// newRecoveryCode returns a random recovery code and the vault key
+// encrypted under it.
+func newRecoveryCode(key []byte) (string, *store.EncryptedSecret, error) {
+	raw, err := crypto.GenerateKey()
+	if err != nil {
+		return "", nil, err
+	}
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw[:20])
+	wrapped, err := encryptSecret(code, key)
+	if err != nil {
+		return "", nil, err
+	}
+	var groups []string
+	for i := 0; i < len(code); i += 4 {
+		groups = append(groups, code[i:i+4])
+	}
+	return strings.Join(groups, "-"), wrapped, nil
+}
+
+// normalizeRecoveryCode undoes the grouping and the case of a typed
+// recovery code, and the digits most easily typed for letters.
+func normalizeRecoveryCode(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\t':
+			return -1
+		case '0':
+			return 'O'
+		case '1':
+			return 'I'
+		case '8':
+			return 'B'
+		}
+		return r
+	}, strings.ToUpper(s))
+}
+
+func printRecoveryCode(code string) {
+	fmt.Println("\nRecovery code (shown only once; keep it offline, away from this machine):")
+	fmt.Printf("\n  %s\n\n", code)
+	fmt.Println("If you forget the master password, 'tele recover' sets a new one with this code. It works once.")
+}
+
+// setMasterPassword replaces the vault's master password, wrapping its vault
+// key under the new one.
+func setMasterPassword(mc *store.MasterConfig, password string, key []byte) error {
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return err
+	}
+	wrapped, err := encryptSecret(password, key)
+	if err != nil {
+		return err
+	}
+	mc.Salt = hex.EncodeToString(salt)
+	mc.PasswordHash = hex.EncodeToString(crypto.HashPassword(password, salt))
+	mc.VaultKey = wrapped
+	mc.VaultKeyCheck = hex.EncodeToString(vaultKeyCheck(key))
+	return store.SaveMaster(mc)
+}
+
+// vaultSecret returns what the vault's keys are derived from, given its
+// verified master password: the password itself, or the vault key.
+func vaultSecret(password string, mc *store.MasterConfig) (string, error) {
+	if mc.VaultKey == nil {
+		return password, nil
+	}
+	key, err := decryptSecret(password, mc.VaultKey)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func vaultKeyCheck(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("tele vault key check\x00"), key...))
+	return sum[:]
+}
+
+// sameVault reports whether two master configs encrypt secrets the same
+// way: under the same vault key, or else the same master password.
+func sameVault(a, b []byte) bool {
+	var ma, mb store.MasterConfig
+	if json.Unmarshal(a, &ma) == nil && json.Unmarshal(b, &mb) == nil &&
+		ma.VaultKeyCheck != "" && mb.VaultKeyCheck != "" {
+		return ma.VaultKeyCheck == mb.VaultKeyCheck
+	}
+	return bytes.Equal(a, b)
+}
+
+// stagedExt marks a file re-encrypted under a new vault key that is not
+// yet in place.
+const stagedExt = ".vaultkey"
+
+// enableVaultKey moves every secret in the vault from the master password
+// to a new random vault key, and records the key in mc wrapped under the
+// password.
+func enableVaultKey(password string, mc *store.MasterConfig) ([]byte, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	secret := hex.EncodeToString(key)
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	// Copies staged by an attempt that stopped before saving its key are
+	// under a key that is lost.
+	if err := removeStaged(dir); err != nil {
+		return nil, err
+	}
+
+	// Everything is decrypted and re-encrypted before anything is written,
+	// so a secret that does not decrypt leaves the vault as it was.
+	files := map[string][]byte{}
+	names, err := store.ListDestinations()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		d, err := store.LoadDestination(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := reencryptDestination(password, secret, d); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if files[filepath.Join(dir, "destinations", name+".json")], err = json.MarshalIndent(d, "", "  "); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range []string{"ca.json", "identity.json"} {
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if files[filepath.Join(dir, path)], err = reencryptFile(path, data, password, secret); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	paths, err := recordingPaths()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for id, path := range paths {
+		if !strings.HasSuffix(path, record.EncryptedExt) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			files[path], err = record.Reencrypt(data, func(salt []byte) []byte {
+				return crypto.DeriveKey(password, salt)
+			}, secret)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("recording %s: %w", id, err)
+		}
+	}
+
+	// The new copies are staged beside the originals and the key saved as
+	// pending before any is moved into place, so that an interruption
+	// never leaves secrets under a key that is not on disk.
+	wrapped, err := encryptSecret(password, key)
+	if err != nil {
+		return nil, err
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path+stagedExt, data, 0600); err != nil {
+			removeStaged(dir)
+			return nil, err
+		}
+	}
+	mc.PendingVaultKey = wrapped
+	if err := store.SaveMaster(mc); err != nil {
+		mc.PendingVaultKey = nil
+		removeStaged(dir)
+		return nil, err
+	}
+	return finishVaultKey(password, mc)
+}
+
+// finishVaultKey moves the copies staged by enableVaultKey into place and
+// makes the pending vault key the vault's. It is safe to run again after
+// an interruption, until it succeeds.
+func finishVaultKey(password string, mc *store.MasterConfig) ([]byte, error) {
+	key, err := decryptSecret(password, mc.PendingVaultKey)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	staged, err := stagedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range staged {
+		if err := os.Rename(path, strings.TrimSuffix(path, stagedExt)); err != nil {
+			return nil, err
+		}
+	}
+	mc.PendingVaultKey = nil
+	if err := setMasterPassword(mc, password, key); err != nil {
+		return nil, err
+	}
+	auditMaster("secrets moved under a vault key")
+	destinationsChanged("Move secrets under a vault key")
+	return key, nil
+}
+
+// stagedFiles lists the copies enableVaultKey staged in dir.
+func stagedFiles(dir string) ([]string, error) {
+	var staged []string
+	err := filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case e.IsDir() && e.Name() == ".git":
+			return filepath.SkipDir
+		case !e.IsDir() && strings.HasSuffix(path, stagedExt):
+			staged = append(staged, path)
+		}
+		return nil
+	})
+	return staged, err
+}
+
+func removeStaged(dir string) error {
+	staged, err := stagedFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, path := range staged {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeShare prints a share with what is needed to use it: the version,
+// the start of the vault key check, the threshold and a checksum against
+// typing mistakes, as hex in groups of four.
+func encodeShare(check []byte, threshold int, s shamir.Share) string {
+	raw := []byte{shareVersion}
+	raw = append(raw, check[:4]...)
+	raw = append(raw, byte(threshold), s.X)
+	raw = append(raw, s.Y...)
+	sum := sha256.Sum256(raw)
+	raw = append(raw, sum[:3]...)
+	h := hex.EncodeToString(raw)
+	var groups []string
+	for len(h) > 4 {
+		groups = append(groups, h[:4])
+		h = h[4:]
+	}
+	return strings.Join(append(groups, h), "-")
+}
+
+// decodeShare parses a share printed by encodeShare for the vault with the
+// given key check, returning it and its threshold.
+func decodeShare(text string, check []byte) (shamir.Share, int, error) {
+	text = strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(text))
+	raw, err := hex.DecodeString(text)
+	if err != nil || len(raw) < 10 {
+		return shamir.Share{}, 0, fmt.Errorf("not a recovery share")
+	}
+	body, sum := raw[:len(raw)-3], raw[len(raw)-3:]
+	want := sha256.Sum256(body)
+	if !bytes.Equal(sum, want[:3]) {
+		return shamir.Share{}, 0, fmt.Errorf("this share has a typo; check it and enter it again")
+	}
+	if body[0] != shareVersion {
+		return shamir.Share{}, 0, fmt.Errorf("unsupported share version %d", body[0])
+	}
+	if !bytes.Equal(body[1:5], check[:4]) {
+		return shamir.Share{}, 0, fmt.Errorf("this share belongs to another vault")
+	}
+	return shamir.Share{X: body[6], Y: body[7:]}, int(body[5]), nil
+}
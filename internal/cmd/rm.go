@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"tele/internal/mux"
 	"tele/internal/store"
 )
 
@@ -12,5 +13,9 @@ func RunRm(name string) {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	// A shared master would otherwise keep serving the removed destination.
+	mux.Stop(name)
+	auditChange(name)
+	destinationsChanged("Remove " + name)
 	fmt.Printf("Destination %q removed.\n", name)
 }
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"tele/internal/remote"
+	"tele/internal/store"
+)
+
+const rotateTimeout = 30 * time.Second
+
+func RunRotate(args []string) {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	generate := fs.Bool("generate", true, "generate the new password; with --generate=false it is prompted for")
+	genOpts := addGenFlags(fs)
+	method := fs.String("method", "", "how to change it remotely: passwd or chpasswd (default chpasswd for root, passwd otherwise)")
+	resume := fs.Bool("resume", false, "finish an interrupted rotation by checking which password the host accepts")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tele rotate [--generate=false | generator options] [--method passwd|chpasswd] [--resume] <name>")
+		os.Exit(1)
+	}
+	name := positional[0]
+
+	requireInit()
+
+	destExists, err := store.DestinationExists(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !destExists {
+		fmt.Fprintf(os.Stderr, "Destination %q not found.\n", name)
+		os.Exit(1)
+	}
+
+	d, err := store.LoadDestination(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading destination: %v\n", err)
+		os.Exit(1)
+	}
+
+	if d.Auth != store.AuthPassword {
+		fmt.Fprintf(os.Stderr, "Destination %q logs in with a %s and has no password to rotate.\n", name, authName(d.Auth))
+		os.Exit(1)
+	}
+
+	masterPass := verifyMasterPassword()
+
+	if *resume {
+		resumeRotation(name, d, masterPass)
+		return
+	}
+	if d.Pending != nil {
+		fmt.Fprintf(os.Stderr, "A previous rotation of %q was not verified. Run 'tele rotate --resume %s' first.\n", name, name)
+		os.Exit(1)
+	}
+
+	switch *method {
+	case "":
+		*method = "passwd"
+		if d.User == "root" {
+			*method = "chpasswd"
+		}
+	case "passwd", "chpasswd":
+	default:
+		fmt.Fprintln(os.Stderr, "--method must be passwd or chpasswd.")
+		os.Exit(1)
+	}
+
+	creds, err := decryptCredentials(masterPass, d)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error decrypting password: %v\n", err)
+		os.Exit(1)
+	}
+	auditDecrypt(name)
+	var newPass string
+	if *generate {
+		newPass = generatePassword(genOpts)
+	} else {
+		newPass = promptNewPassword()
+	}
+
+	// Save the new password as pending before touching the host, so that a
+	// crash after the remote change cannot lose it. The current password
+	// stays in place until a login with the new one succeeds.
+	staged := *d
+	if err := encryptPassword(masterPass, []byte(newPass), &staged); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encrypting password: %v\n", err)
+		os.Exit(1)
+	}
+	d.Pending = &store.PendingPassword{
+		EncryptedPassword: staged.EncryptedPassword,
+		Nonce:             staged.Nonce,
+		Salt:              staged.Salt,
+		Created:           time.Now(),
+	}
+	if err := store.SaveDestination(name, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving destination: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := dialDestination(name, d, creds, remote.DefaultTimeout)
+	if err != nil {
+		abandonRotation(name, d)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Changing password on %s with %s...\n", name, *method)
+	if *method == "chpasswd" {
+		err = remote.ChangePasswordChpasswd(client, d.User, newPass)
+	} else {
+		err = remote.ChangePasswordPasswd(client, creds.Password, newPass, rotateTimeout)
+	}
+	client.Close()
+	if err != nil {
+		// The host may or may not have taken the change; let --resume find out
+		// rather than guessing.
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Both passwords are kept. Run 'tele rotate --resume %s' to settle which one the host accepts.\n", name)
+		os.Exit(1)
+	}
+
+	fmt.Println("Verifying login with the new password...")
+	if err := verifyLogin(name, d.PendingDestination(), remote.Credentials{Password: newPass, TOTP: creds.TOTP, Jump: creds.Jump}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: login with the new password failed: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Both passwords are kept. Run 'tele rotate --resume %s' to retry.\n", name)
+		os.Exit(1)
+	}
+
+	d.PromotePending()
+	if err := store.SaveDestination(name, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving destination: %v\n", err)
+		os.Exit(1)
+	}
+	auditChange(name)
+	syncCommit("Rotate password of " + name)
+	fmt.Printf("Password for %q rotated.\n", name)
+}
+
+// resumeRotation settles an unverified rotation: whichever password the
+// host accepts becomes the current one.
+func resumeRotation(name string, d *store.Destination, masterPass string) {
+	if d.Pending == nil {
+		fmt.Printf("No rotation of %q is pending.\n", name)
+		return
+	}
+
+	creds, err := decryptCredentials(masterPass, d)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error decrypting password: %v\n", err)
+		os.Exit(1)
+	}
+	auditDecrypt(name)
+	pending := d.PendingDestination()
+	newPass, err := decryptPassword(masterPass, pending)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error decrypting pending password: %v\n", err)
+		os.Exit(1)
+	}
+	if err := verifyLogin(name, pending, remote.Credentials{Password: string(newPass), TOTP: creds.TOTP, Jump: creds.Jump}); err == nil {
+		d.PromotePending()
+		if err := store.SaveDestination(name, d); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving destination: %v\n", err)
+			os.Exit(1)
+		}
+		auditChange(name)
+		syncCommit("Rotate password of " + name)
+		fmt.Printf("The host accepts the new password. Password for %q rotated.\n", name)
+		return
+	}
+
+	if err := verifyLogin(name, d, creds); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: the host accepts neither the old nor the new password: %v\n", err)
+		os.Exit(1)
+	}
+	abandonRotation(name, d)
+	fmt.Printf("The host still uses the old password; the pending one was discarded.\n")
+}
+
+// abandonRotation drops a pending password that never reached the host.
+func abandonRotation(name string, d *store.Destination) {
+	d.Pending = nil
+	if err := store.SaveDestination(name, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving destination: %v\n", err)
+		return
+	}
+	syncCommit("Abandon password rotation of " + name)
+}
+
+// verifyLogin opens and closes a fresh connection with the given credentials.
+func verifyLogin(name string, d *store.Destination, creds remote.Credentials) error {
+	defer syncTOTP(name, creds)()
+	client, err := dialLogin(d, creds, remote.DefaultTimeout)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+// promptNewPassword reads a new destination password twice.
+func promptNewPassword() string {
+	fmt.Print("New password: ")
+	pw, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError reading password: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	fmt.Print("Confirm new password: ")
+	confirm, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError reading password: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	if pw == "" {
+		fmt.Fprintln(os.Stderr, "Password cannot be empty.")
+		os.Exit(1)
+	}
+	if pw != confirm {
+		fmt.Fprintln(os.Stderr, "Passwords do not match.")
+		os.Exit(1)
+	}
+	return pw
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"fmt"
+
+	"tele/internal/crypto"
+	"tele/internal/remote"
+	"tele/internal/store"
+	"tele/internal/totp"
+)
+
+// encryptPassword encrypts a destination password under a fresh salt
+// and stores the result on the destination. In a team vault it is
+// encrypted under the destination's data key instead.
+func encryptPassword(masterPass string, password []byte, d *store.Destination) error {
+	key, salt, err := destinationKey(masterPass, d)
+	if err != nil {
+		return err
+	}
+	encPass, nonce, err := crypto.Encrypt(password, key)
+	if err != nil {
+		return err
+	}
+	d.SetCiphertext(encPass, nonce, salt)
+	return nil
+}
+
+// decryptPassword derives the destination key and decrypts its stored password.
+func decryptPassword(masterPass string, d *store.Destination) ([]byte, error) {
+	encPass, nonce, salt, err := d.Ciphertext()
+	if err != nil {
+		return nil, err
+	}
+	key, err := secretKey(masterPass, d, salt)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Decrypt(encPass, nonce, key)
+}
+
+// encryptSecret encrypts an auxiliary secret under a fresh salt.
+func encryptSecret(masterPass string, secret []byte) (*store.EncryptedSecret, error) {
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+	key := crypto.DeriveKey(masterPass, salt)
+	ct, nonce, err := crypto.Encrypt(secret, key)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewEncryptedSecret(ct, nonce, salt), nil
+}
+
+// decryptSecret decrypts an auxiliary secret.
+func decryptSecret(masterPass string, s *store.EncryptedSecret) ([]byte, error) {
+	ct, nonce, salt, err := s.Decode()
+	if err != nil {
+		return nil, err
+	}
+	key := crypto.DeriveKey(masterPass, salt)
+	return crypto.Decrypt(ct, nonce, key)
+}
+
+// encryptDestinationSecret encrypts a secret of d other than its password,
+// such as its TOTP seed, the way its password is.
+func encryptDestinationSecret(masterPass string, d *store.Destination, secret []byte) (*store.EncryptedSecret, error) {
+	key, salt, err := destinationKey(masterPass, d)
+	if err != nil {
+		return nil, err
+	}
+	ct, nonce, err := crypto.Encrypt(secret, key)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewEncryptedSecret(ct, nonce, salt), nil
+}
+
+// decryptDestinationSecret decrypts a secret of d other than its password.
+func decryptDestinationSecret(masterPass string, d *store.Destination, s *store.EncryptedSecret) ([]byte, error) {
+	ct, nonce, salt, err := s.Decode()
+	if err != nil {
+		return nil, err
+	}
+	key, err := secretKey(masterPass, d, salt)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Decrypt(ct, nonce, key)
+}
+
+// destinationKey returns the key to encrypt a new secret of d under, and
+// the salt to store with it. That is d's data key if it has one. A
+// destination created in a team vault gets one; others derive a key from
+// the master password under a fresh salt.
+func destinationKey(masterPass string, d *store.Destination) (key, salt []byte, err error) {
+	if len(d.Keys) > 0 {
+		key, err := unwrapDataKey(masterPass, d)
+		return key, nil, err
+	}
+	fresh := d.EncryptedPassword == "" && d.Pending == nil && d.TOTP == nil
+	if fresh {
+		team, err := store.ReadTeam()
+		if err != nil {
+			return nil, nil, err
+		}
+		if team != nil {
+			if key, err = crypto.GenerateKey(); err != nil {
+				return nil, nil, err
+			}
+			if d.Keys, err = wrapDataKey(key, team); err != nil {
+				return nil, nil, err
+			}
+			return key, nil, nil
+		}
+	}
+	if salt, err = crypto.GenerateSalt(); err != nil {
+		return nil, nil, err
+	}
+	return crypto.DeriveKey(masterPass, salt), salt, nil
+}
+
+// secretKey returns the key a secret of d stored with salt is encrypted
+// under.
+func secretKey(masterPass string, d *store.Destination, salt []byte) ([]byte, error) {
+	if len(d.Keys) > 0 {
+		return unwrapDataKey(masterPass, d)
+	}
+	return crypto.DeriveKey(masterPass, salt), nil
+}
+
+// decryptTOTP decrypts and parses the destination's TOTP seed, if any.
+func decryptTOTP(masterPass string, d *store.Destination) (*totp.Key, error) {
+	if d.TOTP == nil {
+		return nil, nil
+	}
+	seed, err := decryptDestinationSecret(masterPass, d, d.TOTP)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting TOTP secret: %w", err)
+	}
+	return totp.Parse(string(seed))
+}
+
+// decryptCredentials decrypts everything needed to log in to d and to the
+// jump hosts it is reached through. For certificate destinations that is
+// the CA key, and for key destinations the identity file, not a password.
+func decryptCredentials(masterPass string, d *store.Destination) (remote.Credentials, error) {
+	creds, err := decryptLogin(masterPass, d)
+	if err != nil {
+		return remote.Credentials{}, err
+	}
+	if creds.Jump, err = resolveJump(masterPass, d.ProxyJump, 0); err != nil {
+		return remote.Credentials{}, err
+	}
+	return creds, nil
+}
+
+// decryptLogin decrypts the credentials for d itself.
+func decryptLogin(masterPass string, d *store.Destination) (remote.Credentials, error) {
+	var creds remote.Credentials
+	switch d.Auth {
+	case store.AuthCertificate:
+		issue, err := certIssuer(masterPass, d)
+		if err != nil {
+			return remote.Credentials{}, err
+		}
+		creds.Certificate = issue
+	case store.AuthKey:
+		key, err := loadIdentity(d.IdentityFile)
+		if err != nil {
+			return remote.Credentials{}, err
+		}
+		creds.Identity = key
+	default:
+		pass, err := decryptPassword(masterPass, d)
+		if err != nil {
+			return remote.Credentials{}, err
+		}
+		creds.Password = string(pass)
+	}
+	key, err := decryptTOTP(masterPass, d)
+	if err != nil {
+		return remote.Credentials{}, err
+	}
+	creds.TOTP = key
+	return creds, nil
+}
+
+// reencryptDestination moves d's secrets from one master password to
+// another, for restoring a backup made under a different one.
+func reencryptDestination(oldPass, newPass string, d *store.Destination) error {
+	if len(d.Keys) > 0 {
+		// Team vault secrets are wrapped to identities, not the password.
+		return nil
+	}
+	if d.EncryptedPassword != "" {
+		pass, err := decryptPassword(oldPass, d)
+		if err != nil {
+			return fmt.Errorf("decrypting password: %w", err)
+		}
+		if err := encryptPassword(newPass, pass, d); err != nil {
+			return err
+		}
+	}
+	if d.Pending != nil {
+		pass, err := decryptPassword(oldPass, d.PendingDestination())
+		if err != nil {
+			return fmt.Errorf("decrypting pending password: %w", err)
+		}
+		staged := *d
+		if err := encryptPassword(newPass, pass, &staged); err != nil {
+			return err
+		}
+		d.Pending.EncryptedPassword = staged.EncryptedPassword
+		d.Pending.Nonce = staged.Nonce
+		d.Pending.Salt = staged.Salt
+	}
+	if d.TOTP != nil {
+		seed, err := decryptSecret(oldPass, d.TOTP)
+		if err != nil {
+			return fmt.Errorf("decrypting TOTP secret: %w", err)
+		}
+		if d.TOTP, err = encryptSecret(newPass, seed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"tele/internal/config"
+	"tele/internal/record"
+	"tele/internal/remote"
+	"tele/internal/store"
+)
+
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+	keepaliveMaxMiss  = 3
+)
+
+// sessionOptions controls an interactive session run by tele's built-in client.
+type sessionOptions struct {
+	record      bool
+	recordKey   string // master password to encrypt the recording with, if any
+	reconnect   bool
+	keepalive   time.Duration
+	attach      string // "tmux" or "screen"
+	sessionName string
+	sudo        bool // answer sudo's prompt with the password
+}
+
+// goBuiltin runs an interactive session in-process instead of exec'ing
+// sshpass, for the features that need to see or outlive the connection.
+// It returns the exit code to leave with.
+func goBuiltin(name string, d *store.Destination, creds remote.Credentials, opts sessionOptions) int {
+	command := remote.StartupCommand(attachDestination(d, opts))
+
+	client, err := dialDestination(name, d, creds, remote.DefaultTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var rec *record.Recorder
+	if opts.record {
+		rec, err = startRecording(name, d, opts.recordKey)
+		if err != nil {
+			client.Close()
+			fmt.Fprintf(os.Stderr, "Error creating recording: %v\n", err)
+			return 1
+		}
+		defer func() {
+			if err := rec.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving recording: %v\n", err)
+				return
+			}
+			fmt.Fprintln(os.Stderr, "Recording saved.")
+		}()
+	}
+
+	shellOpts := remote.ShellOptions{Command: command}
+	if opts.sudo {
+		shellOpts.SudoPassword = creds.Password
+	}
+	if rec != nil {
+		shellOpts.Output = rec
+		shellOpts.OnResize = func(w, h int) { rec.Resize(w, h) }
+	}
+
+	for {
+		stop := func() {}
+		if opts.keepalive > 0 {
+			stop = remote.KeepAlive(client, opts.keepalive, keepaliveMaxMiss)
+		}
+		code, err := remote.Shell(client, shellOpts)
+		stop()
+		client.Close()
+		if err == nil {
+			return code
+		}
+		if !opts.reconnect {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+
+		client, err = redial(name, d, creds, err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+			return 1
+		}
+		if rec != nil {
+			rec.Marker("reconnected")
+		}
+	}
+}
+
+// redial reconnects with exponential backoff, keeping a status line up to
+// date, until it succeeds. Ctrl-C aborts since the terminal is back in
+// cooked mode between sessions. A changed host key is never retried.
+func redial(name string, d *store.Destination, creds remote.Credentials, cause error) (*ssh.Client, error) {
+	delay := reconnectMinDelay
+	for attempt := 1; ; attempt++ {
+		fmt.Fprintf(os.Stderr, "\r\033[K[tele] connection to %s lost (%v); reconnecting in %s (attempt %d)...",
+			name, cause, delay, attempt)
+		time.Sleep(delay)
+		client, err := dialDestination(name, d, creds, remote.DefaultTimeout)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "\r\033[K[tele] reconnected to %s.\n", name)
+			return client, nil
+		}
+		var mismatch *remote.HostKeyMismatchError
+		if errors.As(err, &mismatch) {
+			return nil, err
+		}
+		cause = err
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+// attachDestination returns d with its startup command replaced by one that
+// creates or reattaches a named tmux or screen session, so a reconnect picks
+// up where the dropped session left off.
+func attachDestination(d *store.Destination, opts sessionOptions) *store.Destination {
+	if opts.attach == "" {
+		return d
+	}
+	cp := *d
+	quoted := remote.Quote(opts.sessionName)
+	switch opts.attach {
+	case "tmux":
+		cp.RemoteCommand = "tmux new-session -A -s " + quoted
+	case "screen":
+		cp.RemoteCommand = "screen -D -RR " + quoted
+	}
+	if d.RemoteCommand != "" {
+		fmt.Fprintf(os.Stderr, "Note: --attach replaces the startup command %q.\n", d.RemoteCommand)
+	}
+	return &cp
+}
+
+// startRecording creates the recording file for a session. It is encrypted
+// when keyPass is non-empty.
+func startRecording(name string, d *store.Destination, keyPass string) (*record.Recorder, error) {
+	dir, err := config.RecordingsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	id := fmt.Sprintf("%s-%s", name, start.Format("20060102-150405"))
+	path := filepath.Join(dir, id+".cast")
+	if keyPass != "" {
+		path += record.EncryptedExt
+	}
+
+	width, height := remote.TermSize()
+	rec, err := record.Create(path, record.Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: start.Unix(),
+		Title:     fmt.Sprintf("%s (%s@%s)", name, d.User, d.Host),
+		Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+		Tele:      &record.Meta{Destination: name, User: d.User, Host: d.Host, Start: start},
+	}, keyPass)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Recording session to %s\n", id)
+	return rec, nil
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"tele/internal/store"
+)
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// promptOptional prompts for an optional value, offering the current one as
+// the default. Entering "-" clears it.
+func promptOptional(prompt, current string) (string, error) {
+	if current != "" {
+		prompt += " (- to clear)"
+	}
+	val, err := promptLine(prompt, current)
+	if err != nil {
+		return "", err
+	}
+	if val == "-" {
+		return "", nil
+	}
+	return val, nil
+}
+
+// authName describes an authentication method in messages.
+func authName(auth string) string {
+	switch auth {
+	case store.AuthCertificate:
+		return "certificate"
+	case store.AuthKey:
+		return "key"
+	}
+	return "password"
+}
+
+// promptAuth asks how to log in to d: with its stored password, with
+// certificates from tele's CA and for which principals, or with a private
+// key file.
+func promptAuth(d *store.Destination) error {
+	def := "password"
+	switch d.Auth {
+	case store.AuthCertificate:
+		def = "cert"
+	case store.AuthKey:
+		def = "key"
+	}
+	for {
+		answer, err := promptLine("Authentication (password/cert/key)", def)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(answer) {
+		case "password", "p":
+			d.Auth = store.AuthPassword
+			d.Principals = nil
+			d.IdentityFile = ""
+			return nil
+		case "cert", "certificate", "c":
+			d.Auth = store.AuthCertificate
+			d.IdentityFile = ""
+			return promptPrincipals(d)
+		case "key", "k":
+			d.Auth = store.AuthKey
+			d.Principals = nil
+			return promptIdentityFile(d)
+		}
+		fmt.Println("Please answer password, cert or key.")
+	}
+}
+
+// promptIdentityFile asks for the private key file d logs in with.
+func promptIdentityFile(d *store.Destination) error {
+	current := d.IdentityFile
+	if current == "" {
+		current = "~/.ssh/id_ed25519"
+	}
+	for {
+		path, err := promptLine("Identity file", current)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(expandHome(path)); err != nil {
+			fmt.Printf("Cannot read %s: %v\n", path, err)
+			continue
+		}
+		d.IdentityFile = path
+		return nil
+	}
+}
+
+// promptPrincipals asks which principals certificates for d carry.
+func promptPrincipals(d *store.Destination) error {
+	if authority, err := store.ReadCA(); err == nil && authority == nil {
+		fmt.Println("Note: there is no certificate authority yet; create one with 'tele ca init'.")
+	}
+	current := strings.Join(d.Principals, ",")
+	if current == "" {
+		current = d.User
+	}
+	line, err := promptLine("Certificate principals (comma-separated)", current)
+	if err != nil {
+		return err
+	}
+	d.Principals = nil
+	for _, p := range strings.Split(line, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			d.Principals = append(d.Principals, p)
+		}
+	}
+	if len(d.Principals) == 1 && d.Principals[0] == d.User {
+		// The login user is the default; don't pin it.
+		d.Principals = nil
+	}
+	return nil
+}
+
+// promptSettings asks for a destination's optional settings, using its
+// current values as defaults. Invalid input is asked for again.
+func promptSettings(d *store.Destination) error {
+	for {
+		line, err := promptOptional("Tags (key=value, comma-separated)", store.FormatPairs(d.Tags))
+		if err != nil {
+			return err
+		}
+		tags, err := store.ParsePairs(line)
+		if err == nil {
+			d.Tags = tags
+			break
+		}
+		fmt.Printf("Invalid tags: %v\n", err)
+	}
+
+	mode, err := promptRecordMode(d.Record)
+	if err != nil {
+		return err
+	}
+	d.Record = mode
+
+	for {
+		line, err := promptOptional("SSH options (Key=Value, semicolon-separated)", strings.Join(d.SSHOptions, "; "))
+		if err != nil {
+			return err
+		}
+		opts, err := parseSSHOptions(line)
+		if err == nil {
+			d.SSHOptions = opts
+			break
+		}
+		fmt.Printf("Invalid SSH options: %v\n", err)
+	}
+
+	for {
+		line, err := promptOptional("Jump hosts (destination names, comma-separated)", d.ProxyJump)
+		if err != nil {
+			return err
+		}
+		missing, err := missingDestinations(jumpHosts(line))
+		if err != nil {
+			return err
+		}
+		if len(missing) == 0 {
+			d.ProxyJump = strings.Join(jumpHosts(line), ",")
+			break
+		}
+		fmt.Printf("Not a destination: %s\n", strings.Join(missing, ", "))
+	}
+
+	for {
+		line, err := promptOptional("Environment (NAME=value, comma-separated)", store.FormatPairs(d.Env))
+		if err != nil {
+			return err
+		}
+		env, err := parseEnv(line)
+		if err == nil {
+			d.Env = env
+			break
+		}
+		fmt.Printf("Invalid environment: %v\n", err)
+	}
+
+	if d.RemoteDir, err = promptOptional("Remote working directory", d.RemoteDir); err != nil {
+		return err
+	}
+	if d.RemoteCommand, err = promptOptional("Startup command", d.RemoteCommand); err != nil {
+		return err
+	}
+	if d.Auth != store.AuthPassword {
+		// There is no stored password to answer with.
+		d.AutoSudo = false
+	} else if d.AutoSudo, err = promptYesNo("Answer sudo password prompts with the stored password", d.AutoSudo); err != nil {
+		return err
+	}
+	if d.PreHook, err = promptOptional("Pre-connect hook", d.PreHook); err != nil {
+		return err
+	}
+	if d.PostHook, err = promptOptional("Post-disconnect hook", d.PostHook); err != nil {
+		return err
+	}
+	return nil
+}
+
+// promptYesNo asks a yes/no question, offering the current answer as the default.
+func promptYesNo(prompt string, current bool) (bool, error) {
+	def := "no"
+	if current {
+		def = "yes"
+	}
+	for {
+		answer, err := promptLine(prompt+" (no/yes)", def)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "no", "n":
+			return false, nil
+		case "yes", "y":
+			return true, nil
+		}
+		fmt.Println("Please answer no or yes.")
+	}
+}
+
+// parseSSHOptions splits a semicolon-separated list of ssh -o options.
+// Semicolons are used because option values such as algorithm lists contain commas.
+func parseSSHOptions(s string) ([]string, error) {
+	var opts []string
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, _, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(key) == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%q is not of the form Key=Value", part)
+		}
+		opts = append(opts, part)
+	}
+	return opts, nil
+}
+
+// parseEnv parses NAME=value pairs, rejecting names a shell could not export.
+func parseEnv(s string) (map[string]string, error) {
+	env, err := store.ParsePairs(s)
+	if err != nil {
+		return nil, err
+	}
+	for name := range env {
+		if !envNameRe.MatchString(name) {
+			return nil, fmt.Errorf("%q is not a valid variable name", name)
+		}
+	}
+	return env, nil
+}
+
+// missingDestinations returns the names that are not saved destinations.
+func missingDestinations(names []string) ([]string, error) {
+	var missing []string
+	for _, name := range names {
+		exists, err := store.DestinationExists(name)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
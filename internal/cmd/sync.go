@@ -0,0 +1,435 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"tele/internal/config"
+	"tele/internal/gitsync"
+	"tele/internal/mux"
+	"tele/internal/store"
+)
+
+// masterCopy is the copy of master.json kept in the synced directory, so
+// machines under different master passwords refuse to mix destinations
+// they could not decrypt. Team vaults have none: each member decrypts with
+// their own identity.
+const masterCopy = ".master.json"
+
+// teamFile lists the members of a team vault.
+const teamFile = ".team.json"
+
+func RunSync(args []string) {
+	usage := "Usage: tele sync [init <remote>]"
+	switch {
+	case len(args) == 0:
+		requireInit()
+		runSync()
+	case args[0] == "init" && len(args) == 2:
+		runSyncInit(args[1])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+func runSyncInit(remote string) {
+	requireInit()
+	dir, err := config.DestinationsDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// A local bare repository can be given as a relative path.
+	if !strings.Contains(remote, ":") {
+		if abs, err := filepath.Abs(expandHome(remote)); err == nil {
+			remote = abs
+		}
+	}
+	if _, err := gitsync.Init(dir, remote); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Destinations in %s are now versioned in git and synced with %s.\n", dir, remote)
+	runSync()
+}
+
+func runSync() {
+	r, err := openSync()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := r.CommitAll("Local changes" + onHost()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	remoteURL, _ := r.Remote()
+	exists, err := r.Fetch()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !exists {
+		pushSync(r, remoteURL)
+		return
+	}
+
+	if err := checkMasterCopy(r, remoteURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ahead, behind, err := r.Divergence()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if behind == 0 {
+		if ahead == 0 {
+			fmt.Println("Already in sync.")
+			return
+		}
+		pushSync(r, remoteURL)
+		return
+	}
+
+	changes, err := r.Changes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	accepted, err := confirmTeamChanges(changes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !accepted {
+		fmt.Fprintln(os.Stderr, "Nothing was pulled. Check the change with your team before syncing again.")
+		os.Exit(1)
+	}
+	if ahead == 0 {
+		if err := r.FastForward(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		reportPulled(changes, nil)
+		fmt.Println("Up to date with " + remoteURL + ".")
+		return
+	}
+
+	remoteTeam, err := r.Show(teamFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	result := map[string]gitsync.Version{}
+	for _, c := range changes {
+		switch {
+		case c.Path == masterCopy:
+			// Each machine keeps its own copy, or none in a team vault.
+			result[c.Path] = c.Local
+			if remoteTeam.Exists {
+				result[c.Path] = gitsync.Version{}
+			}
+		case c.Conflict() && sameApartFromModified(c):
+			// Such as the same host key pinned on both machines: the
+			// local version stands.
+		case c.Conflict():
+			v, err := resolveConflict(c)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			result[c.Path] = v
+		case c.Local.Exists == c.Base.Exists && bytes.Equal(c.Local.Data, c.Base.Data):
+			result[c.Path] = c.Remote
+		}
+	}
+	if err := r.Merge(result, "Merge"+onHost()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	reportPulled(changes, result)
+	pushSync(r, remoteURL)
+}
+
+// checkMasterCopy refuses to sync with a remote whose destinations are
+// encrypted under a different master password. Team vaults on either side
+// are not checked.
+func checkMasterCopy(r *gitsync.Repo, remoteURL string) error {
+	local, err := os.ReadFile(filepath.Join(r.Dir, masterCopy))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if team, err := r.Show(teamFile); err != nil || team.Exists {
+		return err
+	}
+	theirs, err := r.Show(masterCopy)
+	if err != nil {
+		return err
+	}
+	if theirs.Exists && !sameVault(theirs.Data, local) {
+		fmt.Fprintf(os.Stderr, "The destinations on %s are encrypted under a different master password.\n", remoteURL)
+		fmt.Fprintln(os.Stderr, "Sync only works between machines set up with the same master password (restore a backup to copy one),")
+		fmt.Fprintln(os.Stderr, "or in a team vault (see 'tele team').")
+		return fmt.Errorf("master password mismatch")
+	}
+	return nil
+}
+
+// openSync opens the synced destinations directory, refreshing the copy of
+// master.json in it, or removing it in a team vault.
+func openSync() (*gitsync.Repo, error) {
+	dir, err := config.DestinationsDir()
+	if err != nil {
+		return nil, err
+	}
+	r, err := gitsync.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	base, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, teamFile)); err == nil {
+		if err := os.Remove(filepath.Join(dir, masterCopy)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return r, nil
+	}
+	master, err := os.ReadFile(filepath.Join(base, "master.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, masterCopy), master, 0600); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func pushSync(r *gitsync.Repo, remoteURL string) {
+	if err := r.Push(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Pushed to %s.\n", remoteURL)
+}
+
+// reportPulled lists the destinations a pull changed locally. result holds
+// the merged files, or is nil if every remote change was taken.
+func reportPulled(changes []gitsync.Change, result map[string]gitsync.Version) {
+	changed := 0
+	for _, c := range changes {
+		name, ok := strings.CutSuffix(c.Path, ".json")
+		if !ok || strings.HasPrefix(c.Path, ".") {
+			continue
+		}
+		v := c.Remote
+		if result != nil {
+			var taken bool
+			if v, taken = result[c.Path]; !taken {
+				continue
+			}
+		}
+		if v.Exists == c.Local.Exists && bytes.Equal(v.Data, c.Local.Data) {
+			continue
+		}
+		switch {
+		case !v.Exists:
+			fmt.Printf("  removed  %s\n", name)
+		case !c.Local.Exists:
+			fmt.Printf("  added    %s\n", name)
+		default:
+			fmt.Printf("  updated  %s\n", name)
+		}
+		// A shared connection would keep using the old settings.
+		mux.Stop(name)
+		auditChange(name)
+		changed++
+	}
+	if changed > 0 {
+		refreshSSHConfig()
+	}
+}
+
+// confirmTeamChanges lists the members a pull would add to or remove from
+// the team vault, and asks before accepting them. The member list is not
+// signed: anyone who can push to the remote could add themselves, and
+// every destination shared afterwards would be wrapped to their key.
+func confirmTeamChanges(changes []gitsync.Change) (bool, error) {
+	for _, c := range changes {
+		if c.Path != teamFile || (c.Remote.Exists == c.Base.Exists && bytes.Equal(c.Remote.Data, c.Base.Data)) {
+			continue
+		}
+		added, removed, err := memberChanges(c.Local, c.Remote)
+		if err != nil {
+			return false, err
+		}
+		if len(added) == 0 && len(removed) == 0 {
+			return true, nil
+		}
+		fmt.Println("The remote changes the team's members:")
+		var detail []string
+		for _, m := range added {
+			fmt.Printf("  added    %s  %s\n", m.Name, m.PublicKey)
+			detail = append(detail, "added member "+m.Name)
+		}
+		for _, m := range removed {
+			fmt.Printf("  removed  %s  %s\n", m.Name, m.PublicKey)
+			detail = append(detail, "removed member "+m.Name)
+		}
+		fmt.Println("Destinations are shared with every member, so accept only changes your team made.")
+		ok, err := promptYesNo("Accept them", false)
+		if ok {
+			auditTeam(strings.Join(detail, ", ") + " (pulled)")
+		}
+		return ok, err
+	}
+	return true, nil
+}
+
+// memberChanges compares two versions of the team file. A member whose
+// name or key changed is both removed and added.
+func memberChanges(local, remote gitsync.Version) (added, removed []store.Member, err error) {
+	read := func(v gitsync.Version) (map[string]store.Member, error) {
+		members := map[string]store.Member{}
+		if !v.Exists {
+			return members, nil
+		}
+		var t store.Team
+		if err := json.Unmarshal(v.Data, &t); err != nil {
+			return nil, err
+		}
+		for _, m := range t.Members {
+			members[m.Name+" "+m.PublicKey] = m
+		}
+		return members, nil
+	}
+	before, err := read(local)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading the team's members: %w", err)
+	}
+	after, err := read(remote)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading the remote's team members: %w", err)
+	}
+	for k, m := range after {
+		if _, ok := before[k]; !ok {
+			added = append(added, m)
+		}
+	}
+	for k, m := range before {
+		if _, ok := after[k]; !ok {
+			removed = append(removed, m)
+		}
+	}
+	byName := func(ms []store.Member) {
+		sort.Slice(ms, func(i, j int) bool { return ms[i].Name < ms[j].Name })
+	}
+	byName(added)
+	byName(removed)
+	return added, removed, nil
+}
+
+// resolveConflict asks which version to keep of a destination changed both
+// here and on the remote, offering the more recently modified one.
+func resolveConflict(c gitsync.Change) (gitsync.Version, error) {
+	name := strings.TrimSuffix(c.Path, ".json")
+	localTime, remoteTime := modifiedAt(c.Local), modifiedAt(c.Remote)
+	def := "local"
+	if c.Remote.Exists && (!c.Local.Exists || remoteTime.After(localTime)) {
+		def = "remote"
+	}
+	fmt.Printf("%s was changed both here (%s) and on the remote (%s).\n",
+		name, describeVersion(c.Local, localTime), describeVersion(c.Remote, remoteTime))
+	for {
+		answer, err := promptLine("Keep which version (local/remote)", def)
+		if err != nil {
+			return gitsync.Version{}, err
+		}
+		switch strings.ToLower(answer) {
+		case "local", "l":
+			return c.Local, nil
+		case "remote", "r":
+			return c.Remote, nil
+		}
+		fmt.Println("Please answer local or remote.")
+	}
+}
+
+// sameApartFromModified reports whether the local and remote versions of a
+// destination differ only in when they were saved.
+func sameApartFromModified(c gitsync.Change) bool {
+	a, b := c.Local, c.Remote
+	if strings.HasPrefix(c.Path, ".") || !strings.HasSuffix(c.Path, ".json") || !a.Exists || !b.Exists {
+		return false
+	}
+	var da, db store.Destination
+	if json.Unmarshal(a.Data, &da) != nil || json.Unmarshal(b.Data, &db) != nil {
+		return false
+	}
+	da.Modified, db.Modified = time.Time{}, time.Time{}
+	return reflect.DeepEqual(da, db)
+}
+
+// modifiedAt returns when a version of a destination was last saved.
+func modifiedAt(v gitsync.Version) time.Time {
+	var d store.Destination
+	if !v.Exists || json.Unmarshal(v.Data, &d) != nil {
+		return time.Time{}
+	}
+	return d.Modified
+}
+
+func describeVersion(v gitsync.Version, modified time.Time) string {
+	switch {
+	case !v.Exists:
+		return "removed"
+	case modified.IsZero():
+		return "modified at an unknown time"
+	}
+	return "modified " + modified.Local().Format("2006-01-02 15:04:05")
+}
+
+// syncCommit records a change to the destinations in the sync repo, if
+// sync is set up. It is pushed by the next 'tele sync'.
+func syncCommit(message string) {
+	r, err := openSync()
+	if errors.Is(err, gitsync.ErrNotSyncing) {
+		return
+	}
+	if err == nil {
+		_, err = r.CommitAll(message + onHost())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record the change for sync: %v\n", err)
+	}
+}
+
+// destinationsChanged keeps everything derived from the destinations up
+// to date after they change.
+func destinationsChanged(message string) {
+	refreshSSHConfig()
+	syncCommit(message)
+}
+
+func onHost() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return " on " + host
+	}
+	return ""
+}
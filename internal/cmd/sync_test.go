@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"tele/internal/gitsync"
+	"tele/internal/store"
+)
+
+func TestSameApartFromModified(t *testing.T) {
+	version := func(s string) gitsync.Version { return gitsync.Version{Data: []byte(s), Exists: true} }
+	pinned := `{"host": "10.0.0.5", "host_key": "ssh-ed25519 AAAA", "modified": "2026-10-19T08:00:00Z"}`
+	for _, tc := range []struct {
+		desc          string
+		path          string
+		local, remote gitsync.Version
+		want          bool
+	}{
+		{"same pin at different times", "prod.json", version(pinned),
+			version(`{"modified": "2026-10-19T09:30:00Z", "host": "10.0.0.5", "host_key": "ssh-ed25519 AAAA"}`), true},
+		{"different pins", "prod.json", version(pinned),
+			version(`{"host": "10.0.0.5", "host_key": "ssh-ed25519 BBBB", "modified": "2026-10-19T08:00:00Z"}`), false},
+		{"removed on one side", "prod.json", version(pinned), gitsync.Version{}, false},
+		{"team file", ".team.json", version(`{"members": [1]}`), version(`{"members": [2]}`), false},
+	} {
+		c := gitsync.Change{Path: tc.path, Local: tc.local, Remote: tc.remote}
+		if got := sameApartFromModified(c); got != tc.want {
+			t.Errorf("%s: sameApartFromModified = %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestMemberChanges(t *testing.T) {
+	team := func(s string) gitsync.Version {
+		return gitsync.Version{Data: []byte(`{"members": [` + s + `]}`), Exists: true}
+	}
+	alice := `{"name": "alice", "public_key": "x25519:aa", "added": "2026-10-19T08:00:00Z"}`
+	bob := `{"name": "bob", "public_key": "x25519:bb", "added": "2026-10-19T08:00:00Z"}`
+	mallory := `{"name": "bob", "public_key": "x25519:ff", "added": "2026-10-19T08:00:00Z"}`
+	names := func(ms []store.Member) string {
+		var s []string
+		for _, m := range ms {
+			s = append(s, m.Name+" "+m.PublicKey)
+		}
+		return strings.Join(s, ", ")
+	}
+	for _, tc := range []struct {
+		desc           string
+		local, remote  gitsync.Version
+		added, removed string
+	}{
+		{"unchanged", team(alice + "," + bob), team(bob + "," + alice), "", ""},
+		{"member added", team(alice), team(alice + "," + bob), "bob x25519:bb", ""},
+		{"member removed", team(alice + "," + bob), team(alice), "", "bob x25519:bb"},
+		{"key replaced", team(alice + "," + bob), team(alice + "," + mallory), "bob x25519:ff", "bob x25519:bb"},
+		{"new team vault", gitsync.Version{}, team(alice + "," + bob), "alice x25519:aa, bob x25519:bb", ""},
+	} {
+		added, removed, err := memberChanges(tc.local, tc.remote)
+		if err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if names(added) != tc.added || names(removed) != tc.removed {
+			t.Errorf("%s: added %q, removed %q; want %q, %q", tc.desc, names(added), names(removed), tc.added, tc.removed)
+		}
+	}
+	if _, _, err := memberChanges(team(alice), gitsync.Version{Data: []byte("{"), Exists: true}); err == nil {
+		t.Error("no error for a malformed team file")
+	}
+}
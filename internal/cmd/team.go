@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"tele/internal/crypto"
+	"tele/internal/store"
+)
+
+// publicKeyPrefix marks tele's X25519 public keys, so they are not
+// confused with SSH keys when passed around.
+const publicKeyPrefix = "x25519:"
+
+func RunTeam(args []string) {
+	usage := "Usage: tele team init [--name <name>] | identity | members | add-member <name> <public-key> | remove-member <name> | rewrap"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+	requireInit()
+	switch {
+	case args[0] == "init":
+		runTeamInit(args[1:])
+	case args[0] == "identity" && len(args) == 1:
+		runTeamIdentity()
+	case args[0] == "members" && len(args) == 1:
+		runTeamMembers()
+	case args[0] == "add-member" && len(args) == 3:
+		runTeamAddMember(args[1], args[2])
+	case args[0] == "remove-member" && len(args) == 2:
+		runTeamRemoveMember(args[1])
+	case args[0] == "rewrap" && len(args) == 1:
+		runTeamRewrap()
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+func runTeamInit(args []string) {
+	fs := flag.NewFlagSet("team init", flag.ExitOnError)
+	name := fs.String("name", localUser(), "your name in the team")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: tele team init [--name <name>]")
+		os.Exit(1)
+	}
+	if team, err := store.ReadTeam(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	} else if team != nil {
+		fmt.Fprintln(os.Stderr, "This vault is already a team vault; see 'tele team members'.")
+		os.Exit(1)
+	}
+
+	masterPass := verifyMasterPassword()
+	id, err := ensureIdentity(masterPass)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	team := &store.Team{Members: []store.Member{{Name: *name, PublicKey: id.PublicKey, Added: time.Now().UTC()}}}
+	n, _ := shareAll(masterPass, team, false)
+	if err := store.WriteTeam(team); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	auditTeam("started a team vault as " + *name)
+	destinationsChanged("Start a team vault")
+	fmt.Printf("This is now a team vault, with %d destination(s) shared with you (%s) as its only member.\n", n, *name)
+	fmt.Println("To add someone, have them run 'tele team identity' and pass its output to 'tele team add-member <name> <key>'.")
+}
+
+func runTeamIdentity() {
+	id, err := store.ReadIdentity()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if id == nil {
+		if id, err = ensureIdentity(verifyMasterPassword()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Println(id.PublicKey)
+}
+
+func runTeamMembers() {
+	team := requireTeam()
+	id, _ := store.ReadIdentity()
+	width := 0
+	for _, m := range team.Members {
+		width = max(width, len(m.Name))
+	}
+	for _, m := range team.Members {
+		you := ""
+		if id != nil && m.PublicKey == id.PublicKey {
+			you = "  (you)"
+		}
+		fmt.Printf("  %-*s  %s  added %s%s\n", width, m.Name, m.PublicKey, m.Added.Local().Format("2006-01-02"), you)
+	}
+}
+
+func runTeamAddMember(name, publicKey string) {
+	team := requireTeam()
+	if _, err := parsePublicKey(publicKey); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, m := range team.Members {
+		if m.Name == name || m.PublicKey == publicKey {
+			fmt.Fprintf(os.Stderr, "%s is already a member, as %q.\n", name, m.Name)
+			os.Exit(1)
+		}
+	}
+	masterPass := requireMember(team)
+	team.Members = append(team.Members, store.Member{Name: name, PublicKey: publicKey, Added: time.Now().UTC()})
+	n, _ := shareAll(masterPass, team, false)
+	if err := store.WriteTeam(team); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	auditTeam("added member " + name)
+	destinationsChanged("Add team member " + name)
+	fmt.Printf("Shared %d destination(s) with %s. Run 'tele sync' to hand them over.\n", n, name)
+}
+
+func runTeamRemoveMember(name string) {
+	team := requireTeam()
+	idx := -1
+	for i, m := range team.Members {
+		if m.Name == name {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		fmt.Fprintf(os.Stderr, "%s is not a member.\n", name)
+		os.Exit(1)
+	}
+	if id, _ := store.ReadIdentity(); id != nil && team.Members[idx].PublicKey == id.PublicKey {
+		fmt.Fprintln(os.Stderr, "You cannot remove yourself; ask another member to do it.")
+		os.Exit(1)
+	}
+	masterPass := requireMember(team)
+	team.Members = append(team.Members[:idx], team.Members[idx+1:]...)
+	// Data keys the removed member could unwrap are replaced, so copies of
+	// the vault they keep say nothing about later changes.
+	n, failed := shareAll(masterPass, team, true)
+	if len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "%s was not removed: %s could not be re-encrypted, and %s could still decrypt them.\n",
+			name, strings.Join(failed, ", "), name)
+		os.Exit(1)
+	}
+	if err := store.WriteTeam(team); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	auditTeam("removed member " + name)
+	destinationsChanged("Remove team member " + name)
+	fmt.Printf("Removed %s and re-encrypted %d destination(s) under new data keys.\n", name, n)
+	fmt.Printf("%s may still know the passwords they had access to; change them with 'tele rotate'.\n", name)
+}
+
+func runTeamRewrap() {
+	team := requireTeam()
+	masterPass := requireMember(team)
+	n, _ := shareAll(masterPass, team, false)
+	destinationsChanged("Share destinations with the team")
+	fmt.Printf("Shared %d destination(s) with all %d member(s).\n", n, len(team.Members))
+}
+
+// requireTeam exits unless the vault is a team vault.
+func requireTeam() *store.Team {
+	team, err := store.ReadTeam()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if team == nil {
+		fmt.Fprintln(os.Stderr, "This is not a team vault. Run 'tele team init' first.")
+		os.Exit(1)
+	}
+	return team
+}
+
+// requireMember asks for the master password and exits unless this
+// machine's identity is a member of team.
+func requireMember(team *store.Team) string {
+	masterPass := verifyMasterPassword()
+	id, err := store.ReadIdentity()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if id != nil {
+		for _, m := range team.Members {
+			if m.PublicKey == id.PublicKey {
+				return masterPass
+			}
+		}
+	}
+	fmt.Fprintln(os.Stderr, "You are not a member of this team vault; ask a member to add the key 'tele team identity' prints.")
+	os.Exit(1)
+	return ""
+}
+
+// shareAll wraps the data key of every destination with secrets to the
+// members of team, giving those without one a data key first. With fresh,
+// every destination gets a new data key, and none is saved unless all of
+// them could be. It returns the number shared and the names of those that
+// could not be.
+func shareAll(masterPass string, team *store.Team, fresh bool) (int, []string) {
+	names, err := store.ListDestinations()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	n := 0
+	var failed []string
+	updated := map[string]*store.Destination{}
+	for _, name := range names {
+		d, err := store.LoadDestination(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		if d.EncryptedPassword == "" && d.Pending == nil && d.TOTP == nil {
+			continue
+		}
+		if !fresh && wrappedTo(d, team) {
+			n++
+			continue
+		}
+		if err := shareDestination(masterPass, d, team, fresh); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		updated[name] = d
+	}
+	if fresh && len(failed) > 0 {
+		return 0, failed
+	}
+	for _, name := range names {
+		if d, ok := updated[name]; ok {
+			if err := store.SaveDestination(name, d); err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			auditChange(name)
+			n++
+		}
+	}
+	return n, failed
+}
+
+// shareDestination wraps d's data key to the members of team. Unless
+// fresh, a destination that already has a data key keeps it; otherwise
+// its secrets are re-encrypted under a new one.
+func shareDestination(masterPass string, d *store.Destination, team *store.Team, fresh bool) error {
+	if len(d.Keys) > 0 && !fresh {
+		key, err := unwrapDataKey(masterPass, d)
+		if err != nil {
+			return err
+		}
+		d.Keys, err = wrapDataKey(key, team)
+		return err
+	}
+
+	var password, pending, seed []byte
+	var err error
+	if d.EncryptedPassword != "" {
+		if password, err = decryptPassword(masterPass, d); err != nil {
+			return fmt.Errorf("decrypting password: %w", err)
+		}
+	}
+	if d.Pending != nil {
+		if pending, err = decryptPassword(masterPass, d.PendingDestination()); err != nil {
+			return fmt.Errorf("decrypting pending password: %w", err)
+		}
+	}
+	if d.TOTP != nil {
+		if seed, err = decryptDestinationSecret(masterPass, d, d.TOTP); err != nil {
+			return fmt.Errorf("decrypting TOTP secret: %w", err)
+		}
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	keys, err := wrapDataKey(key, team)
+	if err != nil {
+		return err
+	}
+	if password != nil {
+		ct, nonce, err := crypto.Encrypt(password, key)
+		if err != nil {
+			return err
+		}
+		d.SetCiphertext(ct, nonce, nil)
+	}
+	if pending != nil {
+		ct, nonce, err := crypto.Encrypt(pending, key)
+		if err != nil {
+			return err
+		}
+		d.Pending.EncryptedPassword = hex.EncodeToString(ct)
+		d.Pending.Nonce = hex.EncodeToString(nonce)
+		d.Pending.Salt = ""
+	}
+	if seed != nil {
+		ct, nonce, err := crypto.Encrypt(seed, key)
+		if err != nil {
+			return err
+		}
+		d.TOTP = store.NewEncryptedSecret(ct, nonce, nil)
+	}
+	d.Keys = keys
+	return nil
+}
+
+// wrappedTo reports whether d's data key is wrapped to exactly the members
+// of team.
+func wrappedTo(d *store.Destination, team *store.Team) bool {
+	if len(d.Keys) != len(team.Members) {
+		return false
+	}
+	for _, m := range team.Members {
+		if !slices.ContainsFunc(d.Keys, func(k store.WrappedKey) bool { return k.Recipient == m.PublicKey }) {
+			return false
+		}
+	}
+	return true
+}
+
+// wrapDataKey wraps a data key to every member of team.
+func wrapDataKey(key []byte, team *store.Team) ([]store.WrappedKey, error) {
+	keys := make([]store.WrappedKey, 0, len(team.Members))
+	for _, m := range team.Members {
+		pub, err := parsePublicKey(m.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("member %s: %w", m.Name, err)
+		}
+		eph, nonce, ct, err := crypto.WrapKey(key, pub)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, store.WrappedKey{
+			Recipient:  m.PublicKey,
+			Ephemeral:  hex.EncodeToString(eph),
+			Nonce:      hex.EncodeToString(nonce),
+			Ciphertext: hex.EncodeToString(ct),
+		})
+	}
+	return keys, nil
+}
+
+// unwrapDataKey unwraps d's data key with this machine's identity.
+func unwrapDataKey(masterPass string, d *store.Destination) ([]byte, error) {
+	id, private, err := unlockIdentity(masterPass)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range d.Keys {
+		if k.Recipient != id.PublicKey {
+			continue
+		}
+		eph, err1 := hex.DecodeString(k.Ephemeral)
+		nonce, err2 := hex.DecodeString(k.Nonce)
+		ct, err3 := hex.DecodeString(k.Ciphertext)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("decoding wrapped data key")
+		}
+		key, err := crypto.UnwrapKey(private, eph, nonce, ct)
+		if err != nil {
+			return nil, fmt.Errorf("unwrapping data key: %w", err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("not shared with your identity; ask a team member to run 'tele team rewrap' and 'tele sync'")
+}
+
+// unlocked caches the identity's private key, so unwrapping the keys of
+// many destinations decrypts it once.
+var unlocked struct {
+	masterPass string
+	id         *store.Identity
+	private    []byte
+}
+
+// unlockIdentity decrypts this machine's identity.
+func unlockIdentity(masterPass string) (*store.Identity, []byte, error) {
+	if unlocked.id != nil && unlocked.masterPass == masterPass {
+		return unlocked.id, unlocked.private, nil
+	}
+	id, err := store.ReadIdentity()
+	if err != nil {
+		return nil, nil, err
+	}
+	if id == nil {
+		return nil, nil, fmt.Errorf("this machine has no team identity; run 'tele team identity' and ask a member to add it")
+	}
+	private, err := decryptSecret(masterPass, id.PrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decrypting identity: %w", err)
+	}
+	unlocked.masterPass, unlocked.id, unlocked.private = masterPass, id, private
+	return id, private, nil
+}
+
+// ensureIdentity returns this machine's identity, creating it if needed.
+func ensureIdentity(masterPass string) (*store.Identity, error) {
+	id, err := store.ReadIdentity()
+	if err != nil || id != nil {
+		return id, err
+	}
+	private, public, err := crypto.GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := encryptSecret(masterPass, private)
+	if err != nil {
+		return nil, err
+	}
+	id = &store.Identity{
+		PublicKey:  publicKeyPrefix + hex.EncodeToString(public),
+		PrivateKey: encrypted,
+		Created:    time.Now().UTC(),
+	}
+	if err := store.WriteIdentity(id); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// parsePublicKey decodes a public key as 'tele team identity' prints it.
+func parsePublicKey(s string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(s, publicKeyPrefix)
+	key, err := hex.DecodeString(rest)
+	if !ok || err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%q is not a tele public key; get one from 'tele team identity'", s)
+	}
+	return key, nil
+}
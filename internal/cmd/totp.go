@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"tele/internal/store"
+	"tele/internal/totp"
+)
+
+// promptTOTP asks for an optional TOTP seed without echoing it and stores
+// it encrypted on d. Empty input keeps the current seed and "-" removes it.
+// Invalid seeds are asked for again.
+func promptTOTP(masterPass string, d *store.Destination) error {
+	prompt := "TOTP secret (base32 or otpauth:// URI, optional): "
+	if d.TOTP != nil {
+		prompt = "TOTP secret (leave empty to keep, - to remove): "
+	}
+	for {
+		fmt.Print(prompt)
+		seed, err := readPassword()
+		fmt.Println()
+		if err != nil {
+			return err
+		}
+		seed = strings.TrimSpace(seed)
+		switch seed {
+		case "":
+			return nil
+		case "-":
+			d.TOTP = nil
+			return nil
+		}
+		if _, err := totp.Parse(seed); err != nil {
+			fmt.Printf("Invalid TOTP secret: %v\n", err)
+			continue
+		}
+		d.TOTP, err = encryptDestinationSecret(masterPass, d, []byte(seed))
+		return err
+	}
+}
+
+func RunTOTP(name string) {
+	requireInit()
+
+	destExists, err := store.DestinationExists(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !destExists {
+		fmt.Fprintf(os.Stderr, "Destination %q not found.\n", name)
+		os.Exit(1)
+	}
+
+	masterPass := verifyMasterPassword()
+
+	d, err := store.LoadDestination(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading destination: %v\n", err)
+		os.Exit(1)
+	}
+	if d.TOTP == nil {
+		fmt.Fprintf(os.Stderr, "Destination %q has no TOTP secret. Add one with 'tele edit %s'.\n", name, name)
+		os.Exit(1)
+	}
+
+	key, err := decryptTOTP(masterPass, d)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	auditDecrypt(name)
+	now := time.Now()
+	fmt.Println(key.Code(now))
+	fmt.Fprintf(os.Stderr, "Valid for %s.\n", key.Remaining(now))
+}
@@ -30,3 +30,29 @@ func DestinationsDir() (string, error) {
 	}
 	return dest, nil
 }
+
+// RecordingsDir returns the session recordings subdirectory path, creating it if needed.
+func RecordingsDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	rec := filepath.Join(dir, "recordings")
+	if err := os.MkdirAll(rec, 0700); err != nil {
+		return "", err
+	}
+	return rec, nil
+}
+
+// MuxDir returns the directory holding connection sharing sockets, creating it if needed.
+func MuxDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	mux := filepath.Join(dir, "mux")
+	if err := os.MkdirAll(mux, 0700); err != nil {
+		return "", err
+	}
+	return mux, nil
+}
@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+const wrapInfo = "tele key wrap v1"
+
+// GenerateKey returns a random 32-byte key, such as a data key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GenerateIdentity returns a new X25519 private key and its public key.
+func GenerateIdentity() (private, public []byte, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv.Bytes(), priv.PublicKey().Bytes(), nil
+}
+
+// PublicKey returns the public key of an X25519 private key.
+func PublicKey(private []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return priv.PublicKey().Bytes(), nil
+}
+
+// WrapKey encrypts key to an X25519 public key: an ephemeral key pair is
+// agreed with the recipient and the shared secret, through HKDF-SHA256,
+// keys AES-GCM.
+func WrapKey(key, recipient []byte) (ephemeral, nonce, ciphertext []byte, err error) {
+	pub, err := ecdh.X25519().NewPublicKey(recipient)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	secret, err := eph.ECDH(pub)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	wrapKey, err := wrappingKey(secret, eph.PublicKey().Bytes(), recipient)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ciphertext, nonce, err = Encrypt(key, wrapKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return eph.PublicKey().Bytes(), nonce, ciphertext, nil
+}
+
+// UnwrapKey decrypts a key wrapped by WrapKey with the recipient's private
+// key.
+func UnwrapKey(private, ephemeral, nonce, ciphertext []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	eph, err := ecdh.X25519().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := priv.ECDH(eph)
+	if err != nil {
+		return nil, err
+	}
+	wrapKey, err := wrappingKey(secret, ephemeral, priv.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return Decrypt(ciphertext, nonce, wrapKey)
+}
+
+// wrappingKey derives the key wrapping a key from an X25519 shared
+// secret, bound to both public keys.
+func wrappingKey(secret, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	return hkdf.Key(sha256.New, secret, salt, wrapInfo, KeyLen)
+}
@@ -0,0 +1,298 @@
+package gitsync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Branch is the branch synced with the remote.
+const Branch = "main"
+
+const remoteBranch = "origin/" + Branch
+
+// ErrNotSyncing is returned by Open when the directory is not a sync repo.
+var ErrNotSyncing = errors.New("sync is not set up; run 'tele sync init <remote>'")
+
+// Repo is a directory versioned in git and synced with one remote.
+type Repo struct {
+	Dir string
+}
+
+// Open returns the sync repo in dir.
+func Open(dir string) (*Repo, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return nil, ErrNotSyncing
+	}
+	return &Repo{Dir: dir}, nil
+}
+
+// Init makes dir a git repo syncing with remote, which may be a URL or the
+// path of a bare repository.
+func Init(dir, remote string) (*Repo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git is not installed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return nil, fmt.Errorf("%s is already a git repository", dir)
+	}
+	r := &Repo{Dir: dir}
+	steps := [][]string{
+		{"init", "--quiet"},
+		{"symbolic-ref", "HEAD", "refs/heads/" + Branch},
+		{"remote", "add", "origin", remote},
+		{"ls-remote", "origin"},
+	}
+	// Commits need an author; name it after the machine if git has none.
+	if email, _ := r.git("config", "user.email"); email == "" {
+		host, _ := os.Hostname()
+		if host == "" {
+			host = "localhost"
+		}
+		steps = append(steps,
+			[]string{"config", "user.name", "tele"},
+			[]string{"config", "user.email", "tele@" + host})
+	}
+	for _, args := range steps {
+		if _, err := r.git(args...); err != nil {
+			os.RemoveAll(filepath.Join(dir, ".git"))
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Remote returns the URL of the remote.
+func (r *Repo) Remote() (string, error) {
+	return r.git("remote", "get-url", "origin")
+}
+
+// CommitAll commits every change in the directory, and reports whether
+// there was any.
+func (r *Repo) CommitAll(message string) (bool, error) {
+	if _, err := r.git("add", "--all"); err != nil {
+		return false, err
+	}
+	if _, err := r.git("diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+	if _, err := r.git("commit", "--quiet", "-m", message); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Fetch fetches the remote branch, and reports whether it exists yet.
+func (r *Repo) Fetch() (bool, error) {
+	out, err := r.git("ls-remote", "--heads", "origin", Branch)
+	if err != nil {
+		return false, err
+	}
+	if out == "" {
+		return false, nil
+	}
+	if _, err := r.git("fetch", "--quiet", "origin", Branch+":refs/remotes/"+remoteBranch); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Divergence counts the commits only in the local branch and only in the
+// fetched remote branch.
+func (r *Repo) Divergence() (ahead, behind int, err error) {
+	if !r.hasCommits() {
+		return 0, 1, nil
+	}
+	out, err := r.git("rev-list", "--left-right", "--count", "HEAD..."+remoteBranch)
+	if err != nil {
+		return 0, 0, err
+	}
+	f := strings.Fields(out)
+	if len(f) != 2 {
+		return 0, 0, fmt.Errorf("unexpected git rev-list output %q", out)
+	}
+	ahead, _ = strconv.Atoi(f[0])
+	behind, _ = strconv.Atoi(f[1])
+	return ahead, behind, nil
+}
+
+// FastForward moves the local branch to the fetched remote branch.
+func (r *Repo) FastForward() error {
+	if !r.hasCommits() {
+		_, err := r.git("reset", "--quiet", "--hard", remoteBranch)
+		return err
+	}
+	_, err := r.git("merge", "--quiet", "--ff-only", remoteBranch)
+	return err
+}
+
+// Push pushes the local branch to the remote.
+func (r *Repo) Push() error {
+	_, err := r.git("push", "--quiet", "origin", "HEAD:refs/heads/"+Branch)
+	return err
+}
+
+// Version is a file's content in one version of the repo; Exists is false
+// if the file is not in it.
+type Version struct {
+	Data   []byte
+	Exists bool
+}
+
+func (v Version) same(o Version) bool {
+	return v.Exists == o.Exists && bytes.Equal(v.Data, o.Data)
+}
+
+// Change is a file that differs between the local and remote branches,
+// with its version in their common ancestor.
+type Change struct {
+	Path                string
+	Base, Local, Remote Version
+}
+
+// Conflict reports whether the file changed on both sides.
+func (c Change) Conflict() bool {
+	return !c.Local.same(c.Base) && !c.Remote.same(c.Base)
+}
+
+// Changes lists the files that differ between the local and fetched remote
+// branches.
+func (r *Repo) Changes() ([]Change, error) {
+	base, err := r.git("merge-base", "HEAD", remoteBranch)
+	if err != nil {
+		base = "" // unrelated histories: every difference is a conflict
+	}
+	local, err := r.files("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	remote, err := r.files(remoteBranch)
+	if err != nil {
+		return nil, err
+	}
+	baseFiles := map[string]string{}
+	if base != "" {
+		if baseFiles, err = r.files(base); err != nil {
+			return nil, err
+		}
+	}
+
+	paths := map[string]bool{}
+	for p := range local {
+		paths[p] = true
+	}
+	for p := range remote {
+		paths[p] = true
+	}
+	var changes []Change
+	for p := range paths {
+		if local[p] == remote[p] {
+			continue
+		}
+		c := Change{Path: p}
+		if c.Base, err = r.blob(baseFiles[p]); err != nil {
+			return nil, err
+		}
+		if c.Local, err = r.blob(local[p]); err != nil {
+			return nil, err
+		}
+		if c.Remote, err = r.blob(remote[p]); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// Merge records a merge of the fetched remote branch whose tree is the
+// local one with result applied: a file in it is written, or removed if
+// it does not exist.
+func (r *Repo) Merge(result map[string]Version, message string) error {
+	if _, err := r.git("merge", "--quiet", "--no-commit", "--allow-unrelated-histories", "-s", "ours", remoteBranch); err != nil {
+		return err
+	}
+	for p, v := range result {
+		full := filepath.Join(r.Dir, filepath.FromSlash(p))
+		var err error
+		if v.Exists {
+			err = os.WriteFile(full, v.Data, 0600)
+		} else if err = os.Remove(full); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			r.git("merge", "--abort")
+			return err
+		}
+	}
+	if _, err := r.git("add", "--all"); err != nil {
+		return err
+	}
+	_, err := r.git("commit", "--quiet", "-m", message)
+	return err
+}
+
+// Show returns a file's content on the fetched remote branch.
+func (r *Repo) Show(path string) (Version, error) {
+	files, err := r.files(remoteBranch)
+	if err != nil {
+		return Version{}, err
+	}
+	return r.blob(files[path])
+}
+
+func (r *Repo) hasCommits() bool {
+	_, err := r.git("rev-parse", "--verify", "--quiet", "HEAD")
+	return err == nil
+}
+
+// files maps each file in a commit to its blob.
+func (r *Repo) files(rev string) (map[string]string, error) {
+	out, err := r.git("ls-tree", "-r", "-z", rev)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for _, entry := range strings.Split(out, "\x00") {
+		meta, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		if f := strings.Fields(meta); len(f) == 3 && f[1] == "blob" {
+			files[path] = f[2]
+		}
+	}
+	return files, nil
+}
+
+func (r *Repo) blob(id string) (Version, error) {
+	if id == "" {
+		return Version{}, nil
+	}
+	cmd := exec.Command("git", "-C", r.Dir, "cat-file", "blob", id)
+	data, err := cmd.Output()
+	if err != nil {
+		return Version{}, fmt.Errorf("git cat-file %s: %w", id, err)
+	}
+	return Version{Data: data, Exists: true}, nil
+}
+
+// git runs a git command in the repo and returns its trimmed output.
+func (r *Repo) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.Dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
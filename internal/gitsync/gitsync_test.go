@@ -0,0 +1,270 @@
+package gitsync
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// machine is one side of a sync: a directory of files versioned in git.
+type machine struct {
+	t *testing.T
+	*Repo
+}
+
+func (m machine) write(name, data string) {
+	m.t.Helper()
+	if err := os.WriteFile(filepath.Join(m.Dir, name), []byte(data), 0600); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func (m machine) read(name string) string {
+	m.t.Helper()
+	data, err := os.ReadFile(filepath.Join(m.Dir, name))
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return string(data)
+}
+
+func (m machine) commit() {
+	m.t.Helper()
+	if changed, err := m.CommitAll("change"); err != nil || !changed {
+		m.t.Fatalf("CommitAll = %v, %v", changed, err)
+	}
+}
+
+func (m machine) fetch(ahead, behind int) {
+	m.t.Helper()
+	if exists, err := m.Fetch(); err != nil || !exists {
+		m.t.Fatalf("Fetch = %v, %v", exists, err)
+	}
+	a, b, err := m.Divergence()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	if a != ahead || b != behind {
+		m.t.Fatalf("Divergence = %d ahead, %d behind; want %d, %d", a, b, ahead, behind)
+	}
+}
+
+func (m machine) push() {
+	m.t.Helper()
+	if err := m.Push(); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// setup makes a bare repository standing in for the remote, and two
+// machines syncing with it.
+func setup(t *testing.T) (a, b machine) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	// Keep the user's git configuration out, so Init names the author.
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	remote := t.TempDir()
+	if out, err := exec.Command("git", "init", "--quiet", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare: %v: %s", err, out)
+	}
+	for _, m := range []*machine{&a, &b} {
+		r, err := Init(t.TempDir(), remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*m = machine{t, r}
+	}
+	return a, b
+}
+
+func TestInit(t *testing.T) {
+	a, _ := setup(t)
+	if _, err := Init(a.Dir, "/elsewhere"); err == nil {
+		t.Error("Init succeeded on a directory that is already a repository")
+	}
+	if _, err := Open(t.TempDir()); err != ErrNotSyncing {
+		t.Errorf("Open of a plain directory: err = %v", err)
+	}
+	if r, err := Open(a.Dir); err != nil || r.Dir != a.Dir {
+		t.Errorf("Open = %+v, %v", r, err)
+	}
+	if _, err := Init(t.TempDir(), filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Init succeeded with a remote that does not exist")
+	}
+}
+
+func TestFastForward(t *testing.T) {
+	a, b := setup(t)
+
+	if changed, err := a.CommitAll("nothing"); err != nil || changed {
+		t.Fatalf("CommitAll with no files = %v, %v", changed, err)
+	}
+	if exists, err := a.Fetch(); err != nil || exists {
+		t.Fatalf("Fetch of an empty remote = %v, %v", exists, err)
+	}
+	a.write("web.json", "v1")
+	a.commit()
+	if changed, err := a.CommitAll("again"); err != nil || changed {
+		t.Fatalf("CommitAll with nothing new = %v, %v", changed, err)
+	}
+	a.push()
+
+	// b has no commits of its own yet.
+	b.fetch(0, 1)
+	if err := b.FastForward(); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.read("web.json"); got != "v1" {
+		t.Errorf("after the first pull web.json = %q", got)
+	}
+	if v, err := b.Show("web.json"); err != nil || !v.Exists || string(v.Data) != "v1" {
+		t.Errorf("Show = %+v, %v", v, err)
+	}
+	if v, err := b.Show("missing.json"); err != nil || v.Exists {
+		t.Errorf("Show of a missing file = %+v, %v", v, err)
+	}
+
+	a.write("web.json", "v2")
+	a.write("db.json", "db")
+	a.commit()
+	a.push()
+
+	b.fetch(0, 1)
+	if err := b.FastForward(); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.read("web.json") + " " + b.read("db.json"); got != "v2 db" {
+		t.Errorf("after the second pull = %q", got)
+	}
+}
+
+func TestOneSidedChanges(t *testing.T) {
+	a, b := setup(t)
+	a.write("web.json", "v1")
+	a.write("old.json", "old")
+	a.commit()
+	a.push()
+	b.fetch(0, 1)
+	if err := b.FastForward(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a changes web.json and removes old.json; b adds its own file.
+	a.write("web.json", "v2")
+	if err := os.Remove(filepath.Join(a.Dir, "old.json")); err != nil {
+		t.Fatal(err)
+	}
+	a.commit()
+	a.push()
+	b.write("db.json", "db")
+	b.commit()
+
+	b.fetch(1, 1)
+	changes, err := b.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := map[string]Version{}
+	for _, c := range changes {
+		if c.Conflict() {
+			t.Errorf("%s: one-sided change reported as a conflict", c.Path)
+		}
+		switch c.Path {
+		case "web.json":
+			if string(c.Base.Data) != "v1" || string(c.Local.Data) != "v1" || string(c.Remote.Data) != "v2" {
+				t.Errorf("web.json: %+v", c)
+			}
+			result[c.Path] = c.Remote
+		case "old.json":
+			if !c.Local.Exists || c.Remote.Exists {
+				t.Errorf("old.json: %+v", c)
+			}
+			result[c.Path] = c.Remote
+		case "db.json":
+			if c.Base.Exists || !c.Local.Exists || c.Remote.Exists {
+				t.Errorf("db.json: %+v", c)
+			}
+		default:
+			t.Errorf("unexpected change to %s", c.Path)
+		}
+	}
+	if len(changes) != 3 {
+		t.Errorf("got %d changes, want 3", len(changes))
+	}
+
+	if err := b.Merge(result, "merge"); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.read("web.json"); got != "v2" {
+		t.Errorf("web.json = %q after the merge", got)
+	}
+	if _, err := os.Stat(filepath.Join(b.Dir, "old.json")); !os.IsNotExist(err) {
+		t.Errorf("old.json survived the merge: %v", err)
+	}
+	if got := b.read("db.json"); got != "db" {
+		t.Errorf("db.json = %q after the merge", got)
+	}
+	b.fetch(2, 0)
+	b.push()
+
+	a.fetch(0, 2)
+	if err := a.FastForward(); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.read("db.json"); got != "db" {
+		t.Errorf("db.json did not reach a: %q", got)
+	}
+}
+
+func TestConflict(t *testing.T) {
+	a, b := setup(t)
+	a.write("web.json", "v1")
+	a.commit()
+	a.push()
+	b.fetch(0, 1)
+	if err := b.FastForward(); err != nil {
+		t.Fatal(err)
+	}
+
+	a.write("web.json", "from a")
+	a.commit()
+	a.push()
+	b.write("web.json", "from b")
+	b.commit()
+
+	b.fetch(1, 1)
+	changes, err := b.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || !changes[0].Conflict() {
+		t.Fatalf("changes = %+v, want one conflict", changes)
+	}
+	c := changes[0]
+	if string(c.Base.Data) != "v1" || string(c.Local.Data) != "from b" || string(c.Remote.Data) != "from a" {
+		t.Errorf("conflict = %+v", c)
+	}
+
+	// Keeping the local version still records the merge.
+	if err := b.Merge(map[string]Version{}, "merge"); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.read("web.json"); got != "from b" {
+		t.Errorf("web.json = %q after keeping the local version", got)
+	}
+	b.fetch(2, 0)
+	b.push()
+
+	a.fetch(0, 2)
+	if err := a.FastForward(); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.read("web.json"); got != "from b" {
+		t.Errorf("web.json = %q on a after the merge", got)
+	}
+}
@@ -0,0 +1,387 @@
+package mux
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"tele/internal/config"
+)
+
+// Global requests understood by a master on its socket.
+const (
+	requestStatus = "status@tele"
+	requestStop   = "stop@tele"
+)
+
+// Status describes a running master.
+type Status struct {
+	Name     string        `json:"name"`
+	PID      int           `json:"pid"`
+	Addr     string        `json:"addr"`
+	Started  time.Time     `json:"started"`
+	Clients  int           `json:"clients"`
+	Channels int           `json:"channels"`
+	Idle     time.Duration `json:"idle"`
+}
+
+// SocketPath returns the path of a destination's master socket.
+func SocketPath(name string) (string, error) {
+	dir, err := config.MuxDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".sock"), nil
+}
+
+// Dial connects to a destination's running master. It fails quickly when
+// there is none, removing a socket left behind by a master that died.
+func Dial(name string) (*ssh.Client, error) {
+	path, err := SocketPath(name)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			os.Remove(path)
+		}
+		return nil, err
+	}
+	cfg := &ssh.ClientConfig{
+		User: "tele",
+		// The socket's permissions are the access control; the master's
+		// key is ephemeral and only identifies it for the session.
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, "mux:"+name, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// Running lists the names of destinations with a live master.
+func Running() ([]string, error) {
+	dir, err := config.MuxDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".sock")
+		if !ok {
+			continue
+		}
+		if c, err := Dial(name); err == nil {
+			c.Close()
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// QueryStatus asks a destination's master how it is doing.
+func QueryStatus(name string) (*Status, error) {
+	c, err := Dial(name)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	ok, payload, err := c.SendRequest(requestStatus, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("master for %s does not report status", name)
+	}
+	var s Status
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Stop asks a destination's master to close its connection and exit.
+func Stop(name string) error {
+	c, err := Dial(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, _, err = c.SendRequest(requestStop, true, nil)
+	if errors.Is(err, io.EOF) {
+		// The master exited before replying.
+		err = nil
+	}
+	return err
+}
+
+// Master shares one authenticated upstream connection between tele
+// processes, like OpenSSH's ControlMaster. It listens on a Unix socket and
+// speaks SSH there too, with no authentication beyond the socket's
+// permissions, relaying every channel a client opens to the upstream
+// connection. Clients therefore get an ordinary *ssh.Client.
+type Master struct {
+	name     string
+	upstream *ssh.Client
+	idle     time.Duration
+	started  time.Time
+
+	mu       sync.Mutex
+	clients  int
+	channels int
+	lastUsed time.Time
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMaster returns a master for upstream that exits once it has had no
+// open channels for idle.
+func NewMaster(name string, upstream *ssh.Client, idle time.Duration) *Master {
+	now := time.Now()
+	return &Master{
+		name:     name,
+		upstream: upstream,
+		idle:     idle,
+		started:  now,
+		lastUsed: now,
+		done:     make(chan struct{}),
+	}
+}
+
+// Listen creates the master's socket, replacing a stale one. Serve must be
+// called to accept clients.
+func (m *Master) Listen() (net.Listener, error) {
+	path, err := SocketPath(m.name)
+	if err != nil {
+		return nil, err
+	}
+	if c, err := Dial(m.name); err == nil {
+		c.Close()
+		return nil, fmt.Errorf("a master for %s is already running", m.name)
+	}
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve accepts clients on l until the master is stopped, goes idle or
+// loses its upstream connection. It removes the socket before returning.
+func (m *Master) Serve(l net.Listener) error {
+	defer os.Remove(l.Addr().String())
+	defer m.upstream.Close()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return err
+	}
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(signer)
+
+	go func() {
+		m.upstream.Wait()
+		m.stop()
+	}()
+	go m.watchIdle()
+	go func() {
+		<-m.done
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-m.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go m.serveConn(conn, cfg)
+	}
+}
+
+func (m *Master) stop() {
+	m.stopOnce.Do(func() { close(m.done) })
+}
+
+// watchIdle stops the master once no channel has been open for idle.
+// Connections without channels, such as status queries, do not count.
+func (m *Master) watchIdle() {
+	tick := time.NewTicker(min(m.idle, time.Second))
+	defer tick.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-tick.C:
+		}
+		m.mu.Lock()
+		idle := m.channels == 0 && time.Since(m.lastUsed) >= m.idle
+		m.mu.Unlock()
+		if idle {
+			m.stop()
+			return
+		}
+	}
+}
+
+func (m *Master) serveConn(conn net.Conn, cfg *ssh.ServerConfig) {
+	sc, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	m.mu.Lock()
+	m.clients++
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.clients--
+		m.mu.Unlock()
+	}()
+
+	go m.handleGlobal(reqs)
+	for nc := range chans {
+		go m.relay(nc)
+	}
+	sc.Wait()
+}
+
+// handleGlobal answers requests addressed to the master itself. Anything
+// else, such as keepalives, is acknowledged locally: the master keeps the
+// upstream connection alive on its own.
+func (m *Master) handleGlobal(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case requestStatus:
+			payload, _ := json.Marshal(m.status())
+			req.Reply(true, payload)
+		case requestStop:
+			req.Reply(true, nil)
+			m.stop()
+		default:
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+		}
+	}
+}
+
+func (m *Master) status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Status{
+		Name:     m.name,
+		PID:      os.Getpid(),
+		Addr:     m.upstream.RemoteAddr().String(),
+		Started:  m.started,
+		Clients:  m.clients - 1, // not counting the one asking
+		Channels: m.channels,
+	}
+	if s.Channels == 0 {
+		s.Idle = time.Since(m.lastUsed)
+	}
+	return s
+}
+
+// relay opens the same channel upstream and copies data and requests
+// between the two until both sides are done.
+func (m *Master) relay(nc ssh.NewChannel) {
+	up, upReqs, err := m.upstream.OpenChannel(nc.ChannelType(), nc.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			nc.Reject(openErr.Reason, openErr.Message)
+		} else {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	down, downReqs, err := nc.Accept()
+	if err != nil {
+		up.Close()
+		return
+	}
+	m.mu.Lock()
+	m.channels++
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.channels--
+		m.lastUsed = time.Now()
+		m.mu.Unlock()
+	}()
+
+	// Client to upstream.
+	go func() {
+		io.Copy(up, down)
+		up.CloseWrite()
+	}()
+	go func() {
+		forwardRequests(downReqs, up)
+		up.Close()
+	}()
+
+	// Upstream to client. Requests such as exit-status may overtake data
+	// still being copied; the client only treats the channel as finished
+	// once it is closed, which waits for the copies.
+	var output sync.WaitGroup
+	output.Add(2)
+	go func() {
+		io.Copy(down, up)
+		output.Done()
+	}()
+	go func() {
+		io.Copy(down.Stderr(), up.Stderr())
+		output.Done()
+	}()
+	forwardRequests(upReqs, down)
+	output.Wait()
+	down.CloseWrite()
+	down.Close()
+}
+
+func forwardRequests(reqs <-chan *ssh.Request, to ssh.Channel) {
+	for req := range reqs {
+		ok, err := to.SendRequest(req.Type, req.WantReply, req.Payload)
+		if err != nil {
+			ok = false
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package passgen
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+const (
+	lower   = "abcdefghijklmnopqrstuvwxyz"
+	upper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digits  = "0123456789"
+	symbols = "!#%+-.=@^_~"
+
+	// ambiguous characters are easily confused when read or typed by hand.
+	ambiguous = "Il1O0o"
+)
+
+// DefaultLength is the password length used when Options.Length is zero.
+const DefaultLength = 24
+
+// EFF's large wordlist for passphrases, CC BY 3.0:
+// https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases
+//
+//go:embed eff_large_wordlist.txt
+var wordlistText string
+
+var wordlist = sync.OnceValue(func() []string {
+	return strings.Fields(wordlistText)
+})
+
+// Options selects what kind of password New generates. The zero value
+// gives a DefaultLength password using every character class.
+type Options struct {
+	Length           int
+	NoLower          bool
+	NoUpper          bool
+	NoDigits         bool
+	NoSymbols        bool
+	ExcludeAmbiguous bool
+
+	// Words switches to a passphrase of that many words, joined by
+	// Separator. The character options are ignored.
+	Words     int
+	Separator string
+}
+
+// New returns a random password or passphrase along with an estimate of its
+// entropy in bits. Character passwords contain at least one character of
+// each selected class.
+func New(opts Options) (string, float64, error) {
+	if opts.Words > 0 {
+		return passphrase(opts.Words, opts.Separator)
+	}
+
+	length := opts.Length
+	if length == 0 {
+		length = DefaultLength
+	}
+	var classes []string
+	for _, c := range []struct {
+		set  string
+		skip bool
+	}{{lower, opts.NoLower}, {upper, opts.NoUpper}, {digits, opts.NoDigits}, {symbols, opts.NoSymbols}} {
+		if c.skip {
+			continue
+		}
+		if opts.ExcludeAmbiguous {
+			c.set = strip(c.set, ambiguous)
+		}
+		classes = append(classes, c.set)
+	}
+	if len(classes) == 0 {
+		return "", 0, fmt.Errorf("no character classes selected")
+	}
+	if length < len(classes) {
+		return "", 0, fmt.Errorf("length must be at least %d", len(classes))
+	}
+	alphabet := strings.Join(classes, "")
+	for {
+		pw := make([]byte, length)
+		for i := range pw {
+			c, err := pick(alphabet)
+			if err != nil {
+				return "", 0, err
+			}
+			pw[i] = c
+		}
+		if hasEvery(string(pw), classes) {
+			return string(pw), float64(length) * math.Log2(float64(len(alphabet))), nil
+		}
+	}
+}
+
+// passphrase joins n words chosen uniformly from the wordlist.
+func passphrase(n int, sep string) (string, float64, error) {
+	words := wordlist()
+	chosen := make([]string, n)
+	for i := range chosen {
+		k, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+		if err != nil {
+			return "", 0, err
+		}
+		chosen[i] = words[k.Int64()]
+	}
+	return strings.Join(chosen, sep), float64(n) * math.Log2(float64(len(words))), nil
+}
+
+// pick returns a uniformly random byte of s.
+func pick(s string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(s))))
+	if err != nil {
+		return 0, err
+	}
+	return s[n.Int64()], nil
+}
+
+func hasEvery(pw string, classes []string) bool {
+	for _, class := range classes {
+		if !strings.ContainsAny(pw, class) {
+			return false
+		}
+	}
+	return true
+}
+
+// strip removes every character of drop from s.
+func strip(s, drop string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(drop, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
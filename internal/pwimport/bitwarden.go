@@ -0,0 +1,90 @@
+package pwimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Collections []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"collections"`
+	Items []struct {
+		Type          int      `json:"type"`
+		Name          string   `json:"name"`
+		FolderID      string   `json:"folderId"`
+		CollectionIDs []string `json:"collectionIds"`
+		Fields        []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"fields"`
+		Login *struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TOTP     string `json:"totp"`
+			URIs     []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+		} `json:"login"`
+	} `json:"items"`
+}
+
+// bitwardenLogin is the item type of logins; cards, identities and notes
+// are skipped.
+const bitwardenLogin = 1
+
+// ParseBitwarden reads an unencrypted Bitwarden JSON export, personal or
+// organization. An item's folder is its folder, or in organization exports
+// its first collection.
+func ParseBitwarden(r io.Reader) ([]Entry, error) {
+	var x bitwardenExport
+	if err := json.NewDecoder(r).Decode(&x); err != nil {
+		return nil, fmt.Errorf("not a Bitwarden JSON export: %w", err)
+	}
+	if x.Encrypted {
+		return nil, fmt.Errorf("the export is encrypted; export the vault as unencrypted JSON")
+	}
+	folders := map[string]string{}
+	for _, f := range x.Folders {
+		folders[f.ID] = f.Name
+	}
+	for _, c := range x.Collections {
+		folders[c.ID] = c.Name
+	}
+
+	var entries []Entry
+	for _, it := range x.Items {
+		if it.Type != bitwardenLogin || it.Login == nil {
+			continue
+		}
+		e := Entry{
+			Title:    it.Name,
+			Folder:   folders[it.FolderID],
+			Username: it.Login.Username,
+			Password: it.Login.Password,
+			TOTP:     it.Login.TOTP,
+			Fields:   map[string]string{},
+		}
+		if e.Folder == "" && len(it.CollectionIDs) > 0 {
+			e.Folder = folders[it.CollectionIDs[0]]
+		}
+		for _, u := range it.Login.URIs {
+			if u.URI != "" {
+				e.URLs = append(e.URLs, u.URI)
+			}
+		}
+		for _, f := range it.Fields {
+			e.Fields[strings.ToLower(f.Name)] = f.Value
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,93 @@
+package pwimport
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvColumns maps the header names password managers use to entry fields.
+// Columns not listed become custom fields.
+var csvColumns = map[string]string{
+	"name":           "title",
+	"title":          "title",
+	"folder":         "folder",
+	"group":          "folder",
+	"grouping":       "folder",
+	"url":            "url",
+	"uri":            "url",
+	"login_uri":      "url",
+	"username":       "username",
+	"user":           "username",
+	"login":          "username",
+	"login_username": "username",
+	"password":       "password",
+	"login_password": "password",
+	"totp":           "totp",
+	"otp":            "totp",
+	"login_totp":     "totp",
+}
+
+// ParseCSV reads a CSV export with a header row, such as those of
+// Bitwarden, KeePassXC, LastPass and browsers. Columns are recognized by
+// name; host and port columns are kept as custom fields.
+func ParseCSV(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	cols := make([]string, len(header))
+	known := false
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if f, ok := csvColumns[h]; ok {
+			cols[i] = f
+			known = known || f == "url" || f == "password"
+		} else {
+			cols[i] = "field:" + h
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("the CSV header has no url or password column")
+	}
+
+	var entries []Entry
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := Entry{Fields: map[string]string{}}
+		for i, v := range rec {
+			if i >= len(cols) {
+				break
+			}
+			switch cols[i] {
+			case "title":
+				e.Title = v
+			case "folder":
+				e.Folder = strings.ReplaceAll(strings.Trim(v, "/"), "\\", "/")
+			case "url":
+				if v != "" {
+					e.URLs = append(e.URLs, v)
+				}
+			case "username":
+				e.Username = v
+			case "password":
+				e.Password = v
+			case "totp":
+				e.TOTP = v
+			default:
+				e.Fields[strings.TrimPrefix(cols[i], "field:")] = v
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,96 @@
+package pwimport
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type keepassFile struct {
+	XMLName        xml.Name     `xml:"KeePassFile"`
+	RecycleBinUUID string       `xml:"Meta>RecycleBinUUID"`
+	Groups         []keepassGrp `xml:"Root>Group"`
+}
+
+type keepassGrp struct {
+	UUID    string         `xml:"UUID"`
+	Name    string         `xml:"Name"`
+	Entries []keepassEntry `xml:"Entry"`
+	Groups  []keepassGrp   `xml:"Group"`
+}
+
+// keepassEntry holds an entry's current fields; its History is ignored.
+type keepassEntry struct {
+	Strings []struct {
+		Key   string `xml:"Key"`
+		Value struct {
+			Text      string `xml:",chardata"`
+			Protected string `xml:"Protected,attr"`
+		} `xml:"Value"`
+	} `xml:"String"`
+}
+
+// ParseKeePass reads a KeePass 2 XML export, as written by KeePass and
+// KeePassXC. The database's top group is left out of folder paths, and the
+// recycle bin is skipped.
+func ParseKeePass(r io.Reader) ([]Entry, error) {
+	var f keepassFile
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("not a KeePass XML export: %w", err)
+	}
+	var entries []Entry
+	var walk func(g keepassGrp, path string) error
+	walk = func(g keepassGrp, path string) error {
+		if f.RecycleBinUUID != "" && g.UUID == f.RecycleBinUUID {
+			return nil
+		}
+		for _, ke := range g.Entries {
+			e := Entry{Folder: path, Fields: map[string]string{}}
+			for _, s := range ke.Strings {
+				if strings.EqualFold(s.Value.Protected, "true") {
+					return fmt.Errorf("field values are encrypted; export the database as plain XML")
+				}
+				v := s.Value.Text
+				switch s.Key {
+				case "Title":
+					e.Title = v
+				case "UserName":
+					e.Username = v
+				case "Password":
+					e.Password = v
+				case "URL":
+					if v != "" {
+						e.URLs = append(e.URLs, v)
+					}
+				case "Notes":
+				default:
+					e.Fields[strings.ToLower(s.Key)] = v
+				}
+			}
+			// KeePassXC keeps an otpauth URI in "otp", KeePass a base32
+			// secret in "TimeOtp-Secret-Base32".
+			e.TOTP = e.Field("otp", "timeotp-secret-base32")
+			entries = append(entries, e)
+		}
+		for _, sub := range g.Groups {
+			if err := walk(sub, joinFolder(path, sub.Name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, top := range f.Groups {
+		if err := walk(top, ""); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func joinFolder(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
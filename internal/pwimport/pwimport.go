@@ -0,0 +1,113 @@
+package pwimport
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Entry is a login read from a password manager export.
+type Entry struct {
+	Title string
+	// Folder is the folder, collection or group path, "/"-separated.
+	Folder   string
+	URLs     []string
+	Username string
+	Password string
+	TOTP     string
+	// Fields are custom fields, keyed by lower-cased name.
+	Fields map[string]string
+}
+
+// Field returns the first non-empty custom field among names.
+func (e *Entry) Field(names ...string) string {
+	for _, n := range names {
+		if v := strings.TrimSpace(e.Fields[n]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// InFolder reports whether the entry is in folder or one of its
+// subfolders. Case is ignored.
+func (e *Entry) InFolder(folder string) bool {
+	f := strings.ToLower(strings.Trim(folder, "/"))
+	g := strings.ToLower(e.Folder)
+	return g == f || strings.HasPrefix(g, f+"/")
+}
+
+// Address is where an entry logs in over SSH.
+type Address struct {
+	Host string
+	Port string
+	User string
+}
+
+// ParseAddress parses an SSH address: an ssh:// (or sftp:// or scp://) URL
+// such as ssh://user@host:port, or a bare host, host:port or user@host.
+// Other URLs, such as those of websites, are not SSH addresses.
+func ParseAddress(s string) (Address, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Address{}, fmt.Errorf("empty address")
+	}
+	if i := strings.Index(s, "://"); i >= 0 {
+		scheme := strings.ToLower(s[:i])
+		if scheme != "ssh" && scheme != "sftp" && scheme != "scp" {
+			return Address{}, fmt.Errorf("%s URL is not an SSH address", scheme)
+		}
+	} else {
+		if strings.ContainsAny(s, "/ ") {
+			return Address{}, fmt.Errorf("%q is not an SSH address", s)
+		}
+		s = "ssh://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return Address{}, err
+	}
+	a := Address{Host: u.Hostname(), Port: u.Port()}
+	if u.User != nil {
+		a.User = u.User.Username()
+		// ssh://user;fingerprint=...@host, from the URI draft.
+		a.User, _, _ = strings.Cut(a.User, ";")
+	}
+	if a.Host == "" {
+		return Address{}, fmt.Errorf("%q has no host", s)
+	}
+	if a.Port != "" {
+		if err := CheckPort(a.Port); err != nil {
+			return Address{}, err
+		}
+	}
+	if a.User != "" {
+		if err := CheckUser(a.User); err != nil {
+			return Address{}, err
+		}
+	}
+	if strings.Contains(a.Host, ":") && net.ParseIP(a.Host) == nil {
+		return Address{}, fmt.Errorf("invalid host %q", a.Host)
+	}
+	return a, nil
+}
+
+// CheckPort reports whether p is a TCP port number.
+func CheckPort(p string) error {
+	if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", p)
+	}
+	return nil
+}
+
+// CheckUser reports whether u can be a login name: one word with no
+// control characters, which would otherwise reach the exported ssh_config.
+func CheckUser(u string) error {
+	if u == "" || strings.IndexFunc(u, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return fmt.Errorf("invalid username %q", u)
+	}
+	return nil
+}
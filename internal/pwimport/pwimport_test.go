@@ -0,0 +1,147 @@
+package pwimport
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	otp := "otpauth://totp/db1?secret=GEZDGNBVGY3TQOJQ"
+	for _, tc := range []struct {
+		file  string
+		parse func(io.Reader) ([]Entry, error)
+		want  []Entry
+	}{
+		{"keepass.xml", ParseKeePass, []Entry{
+			{
+				Title:    "router",
+				URLs:     []string{"ssh://admin@192.0.2.1:2222"},
+				Username: "admin",
+				Password: "r0uter!",
+				Fields:   map[string]string{},
+			},
+			{
+				Title:    "db1",
+				Folder:   "Servers/Prod",
+				Username: "postgres",
+				Password: "s3cret",
+				TOTP:     otp,
+				Fields:   map[string]string{"host": "db1.example.com", "otp": otp},
+			},
+		}},
+		{"bitwarden.json", ParseBitwarden, []Entry{
+			{
+				Title:    "bastion",
+				Folder:   "Ops/Linux",
+				URLs:     []string{"ssh://bastion.example.com"},
+				Username: "ops",
+				Password: "b4stion",
+				TOTP:     "JBSWY3DPEHPK3PXP",
+				Fields:   map[string]string{"port": "2200"},
+			},
+			{
+				Title:    "wiki",
+				Folder:   "Shared",
+				URLs:     []string{"https://wiki.example.com"},
+				Username: "me",
+				Password: "pw",
+				Fields:   map[string]string{},
+			},
+		}},
+		// A LastPass export: grouping becomes the folder, and the quoted
+		// password keeps its comma and quote.
+		{"lastpass.csv", ParseCSV, []Entry{
+			{
+				Title:    "web1",
+				Folder:   "Servers/Web",
+				URLs:     []string{"ssh://root@10.0.0.5"},
+				Username: "root",
+				Password: `pa,ss"word`,
+				Fields:   map[string]string{"extra": "Host: x", "fav": "0"},
+			},
+			{
+				Title:    "mail",
+				URLs:     []string{"https://mail.example.com"},
+				Username: "me",
+				Password: "mailpw",
+				Fields:   map[string]string{"extra": "", "fav": "1"},
+			},
+		}},
+	} {
+		f, err := os.Open(filepath.Join("testdata", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tc.parse(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tc.file, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\n got  %+v\n want %+v", tc.file, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		file  string
+		parse func(io.Reader) ([]Entry, error)
+		want  string
+	}{
+		{"keepass-protected.xml", ParseKeePass, "encrypted"},
+		{"bitwarden-encrypted.json", ParseBitwarden, "encrypted"},
+		{"nocolumns.csv", ParseCSV, "column"},
+	} {
+		f, err := os.Open(filepath.Join("testdata", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tc.parse(f)
+		f.Close()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want one mentioning %q", tc.file, err, tc.want)
+		}
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Address
+	}{
+		{"host.example.com", Address{Host: "host.example.com"}},
+		{"root@10.0.0.5", Address{Host: "10.0.0.5", User: "root"}},
+		{"host:2222", Address{Host: "host", Port: "2222"}},
+		{"ssh://deploy@host:22", Address{Host: "host", Port: "22", User: "deploy"}},
+		{"SFTP://host", Address{Host: "host"}},
+		{"ssh://user;fingerprint=ssh-rsa-abc@host", Address{Host: "host", User: "user"}},
+		{"ssh://[2001:db8::1]:2200", Address{Host: "2001:db8::1", Port: "2200"}},
+	} {
+		got, err := ParseAddress(tc.in)
+		if err != nil {
+			t.Errorf("ParseAddress(%q): %v", tc.in, err)
+		} else if got != tc.want {
+			t.Errorf("ParseAddress(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "https://example.com", "host/path", "two words", "host:0", "host:99999", "ssh://", "ssh://a%0Ab@host", "ssh://a%20b@host"} {
+		if a, err := ParseAddress(in); err == nil {
+			t.Errorf("ParseAddress(%q) = %+v, want an error", in, a)
+		}
+	}
+}
+
+func TestEntryFolderAndFields(t *testing.T) {
+	e := Entry{Folder: "Servers/Prod", Fields: map[string]string{"port": " ", "ssh port": "2200"}}
+	for folder, want := range map[string]bool{"servers": true, "/Servers/Prod/": true, "Serv": false, "Servers/Prod/db": false} {
+		if got := e.InFolder(folder); got != want {
+			t.Errorf("InFolder(%q) = %v, want %v", folder, got, want)
+		}
+	}
+	if got := e.Field("port", "ssh port"); got != "2200" {
+		t.Errorf("Field skipped a blank field to %q, want 2200", got)
+	}
+}
@@ -0,0 +1,421 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"tele/internal/crypto"
+)
+
+// EncryptedExt is appended to recordings encrypted with the vault key.
+const EncryptedExt = ".enc"
+
+// Meta describes the session a recording belongs to.
+type Meta struct {
+	Destination string    `json:"destination"`
+	User        string    `json:"user"`
+	Host        string    `json:"host"`
+	Start       time.Time `json:"start"`
+}
+
+// Header is the first line of an asciicast v2 file. The tele key is an
+// extension that players ignore.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Tele      *Meta             `json:"tele,omitempty"`
+}
+
+// Event is one timed asciicast event: "o" for output, "r" for a resize,
+// "m" for a marker.
+type Event struct {
+	Time float64
+	Type string
+	Data string
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{e.Time, e.Type, e.Data})
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return fmt.Errorf("event has %d fields, want 3", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw[1], &e.Type); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw[2], &e.Data)
+}
+
+// envelope is the cleartext first line of an encrypted recording. It carries
+// only what `tele recordings list` needs; the cast itself follows as one
+// AES-GCM sealed line per cast line.
+type envelope struct {
+	Encrypted   int       `json:"tele_encrypted_cast"`
+	Salt        string    `json:"salt"`
+	Destination string    `json:"destination"`
+	Start       time.Time `json:"start"`
+}
+
+// Recorder writes a session to an asciicast v2 file as it happens.
+type Recorder struct {
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	key     []byte
+	start   time.Time
+	pending []byte
+}
+
+// Create starts a recording at path. If masterPass is non-empty the
+// recording is encrypted under a key derived from it and a fresh salt.
+func Create(path string, h Header, masterPass string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{f: f, w: bufio.NewWriter(f), start: time.Now()}
+
+	if masterPass != "" {
+		salt, err := crypto.GenerateSalt()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		r.key = crypto.DeriveKey(masterPass, salt)
+		env := envelope{Encrypted: 1, Salt: hex.EncodeToString(salt)}
+		if h.Tele != nil {
+			env.Destination = h.Tele.Destination
+			env.Start = h.Tele.Start
+		}
+		data, err := json.Marshal(env)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		r.w.Write(append(data, '\n'))
+	}
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := r.writeLine(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write records terminal output. Incomplete UTF-8 sequences at the end of p
+// are held back until the rest arrives, so events never split a character.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buf := append(r.pending, p...)
+	cut := len(buf)
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), buf[cut:]...)
+	if cut == 0 {
+		return len(p), nil
+	}
+	if err := r.event("o", string(buf[:cut])); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Resize records a terminal size change.
+func (r *Recorder) Resize(width, height int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.event("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// Marker records a named marker, such as a reconnect.
+func (r *Recorder) Marker(label string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.event("m", label)
+}
+
+// Close flushes any held-back output and closes the file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+func (r *Recorder) event(typ, data string) error {
+	line, err := json.Marshal(Event{Time: time.Since(r.start).Seconds(), Type: typ, Data: data})
+	if err != nil {
+		return err
+	}
+	if err := r.writeLine(line); err != nil {
+		return err
+	}
+	// Flush every event so an abrupt exit loses as little as possible.
+	return r.w.Flush()
+}
+
+func (r *Recorder) writeLine(line []byte) error {
+	if r.key == nil {
+		_, err := r.w.Write(append(line, '\n'))
+		return err
+	}
+	ct, nonce, err := crypto.Encrypt(line, r.key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(r.w, "%x:%x\n", nonce, ct)
+	return err
+}
+
+// Info is what can be learned about a recording without decrypting it.
+type Info struct {
+	Encrypted   bool
+	Destination string
+	Start       time.Time
+	Duration    time.Duration // zero when encrypted
+}
+
+// Stat reads a recording's metadata. Encrypted recordings only expose
+// their cleartext envelope.
+func Stat(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+
+	sc := newScanner(f)
+	if !sc.Scan() {
+		return Info{}, fmt.Errorf("%s: empty recording", path)
+	}
+	first := sc.Bytes()
+
+	if strings.HasSuffix(path, EncryptedExt) {
+		var env envelope
+		if err := json.Unmarshal(first, &env); err != nil {
+			return Info{}, fmt.Errorf("%s: %w", path, err)
+		}
+		return Info{Encrypted: true, Destination: env.Destination, Start: env.Start}, nil
+	}
+
+	var h Header
+	if err := json.Unmarshal(first, &h); err != nil {
+		return Info{}, fmt.Errorf("%s: %w", path, err)
+	}
+	info := Info{Start: time.Unix(h.Timestamp, 0)}
+	if h.Tele != nil {
+		info.Destination = h.Tele.Destination
+		info.Start = h.Tele.Start
+	}
+	var last Event
+	for sc.Scan() {
+		var e Event
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			last = e
+		}
+	}
+	info.Duration = time.Duration(last.Time * float64(time.Second))
+	return info, sc.Err()
+}
+
+// Load reads a whole recording. For encrypted recordings, keyFn is called
+// with the recording's salt and must return the derived key.
+func Load(path string, keyFn func(salt []byte) []byte) (Header, []Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	defer f.Close()
+
+	sc := newScanner(f)
+	var key []byte
+	if strings.HasSuffix(path, EncryptedExt) {
+		if !sc.Scan() {
+			return Header{}, nil, fmt.Errorf("%s: empty recording", path)
+		}
+		var env envelope
+		if err := json.Unmarshal(sc.Bytes(), &env); err != nil {
+			return Header{}, nil, err
+		}
+		salt, err := hex.DecodeString(env.Salt)
+		if err != nil {
+			return Header{}, nil, fmt.Errorf("decoding salt: %w", err)
+		}
+		key = keyFn(salt)
+	}
+
+	next := func() ([]byte, bool, error) {
+		if !sc.Scan() {
+			return nil, false, sc.Err()
+		}
+		line := sc.Bytes()
+		if key == nil {
+			return line, true, nil
+		}
+		nonceHex, ctHex, ok := strings.Cut(string(line), ":")
+		if !ok {
+			return nil, false, fmt.Errorf("malformed encrypted line")
+		}
+		nonce, err := hex.DecodeString(nonceHex)
+		if err != nil {
+			return nil, false, err
+		}
+		ct, err := hex.DecodeString(ctHex)
+		if err != nil {
+			return nil, false, err
+		}
+		pt, err := crypto.Decrypt(ct, nonce, key)
+		return pt, err == nil, err
+	}
+
+	line, ok, err := next()
+	if err != nil {
+		return Header{}, nil, err
+	}
+	if !ok {
+		return Header{}, nil, fmt.Errorf("%s: missing header", path)
+	}
+	var h Header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return Header{}, nil, fmt.Errorf("parsing header: %w", err)
+	}
+
+	var events []Event
+	for {
+		line, ok, err := next()
+		if err != nil {
+			return h, events, err
+		}
+		if !ok {
+			return h, events, nil
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return h, events, fmt.Errorf("parsing event: %w", err)
+		}
+		events = append(events, e)
+	}
+}
+
+// Reencrypt returns an encrypted recording's contents re-encrypted under a
+// key derived from masterPass and a fresh salt. keyFn returns the current
+// key for the recording's salt, as for Load.
+func Reencrypt(data []byte, keyFn func(salt []byte) []byte, masterPass string) ([]byte, error) {
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	var env envelope
+	if err := json.Unmarshal([]byte(lines[0]), &env); err != nil {
+		return nil, err
+	}
+	oldSalt, err := hex.DecodeString(env.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("decoding salt: %w", err)
+	}
+	oldKey := keyFn(oldSalt)
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+	key := crypto.DeriveKey(masterPass, salt)
+	env.Salt = hex.EncodeToString(salt)
+
+	head, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.Write(append(head, '\n'))
+	for _, line := range lines[1:] {
+		nonceHex, ctHex, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed encrypted line")
+		}
+		nonce, err1 := hex.DecodeString(nonceHex)
+		ct, err2 := hex.DecodeString(ctHex)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("malformed encrypted line")
+		}
+		pt, err := crypto.Decrypt(ct, nonce, oldKey)
+		if err != nil {
+			return nil, err
+		}
+		if ct, nonce, err = crypto.Encrypt(pt, key); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "%x:%x\n", nonce, ct)
+	}
+	return out.Bytes(), nil
+}
+
+// Play writes output events to w with their original timing, scaled by
+// speed. Pauses longer than idle are shortened to idle when idle > 0.
+func Play(w io.Writer, events []Event, speed float64, idle time.Duration) error {
+	if speed <= 0 {
+		speed = 1
+	}
+	prev := 0.0
+	for _, e := range events {
+		delay := time.Duration((e.Time - prev) / speed * float64(time.Second))
+		if idle > 0 && delay > idle {
+			delay = idle
+		}
+		prev = e.Time
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		if e.Type != "o" {
+			continue
+		}
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return sc
+}
@@ -0,0 +1,49 @@
+package remote
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeepAlive sends an OpenSSH keepalive request every interval and closes
+// the client once maxMissed requests in a row go unanswered, so that a
+// silently dead link surfaces as an error instead of a frozen session.
+// The returned function stops the keepalives.
+func KeepAlive(client *ssh.Client, interval time.Duration, maxMissed int) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		missed := 0
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			reply := make(chan error, 1)
+			go func() {
+				_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+				reply <- err
+			}()
+			select {
+			case <-done:
+				return
+			case err := <-reply:
+				if err != nil {
+					client.Close()
+					return
+				}
+				missed = 0
+			case <-time.After(interval):
+				missed++
+				if missed >= maxMissed {
+					client.Close()
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,72 @@
+package remote
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// applyOptions sets the algorithm lists chosen by ssh -o options, in
+// OpenSSH's syntax: a list replaces the defaults, and one starting with +,
+// - or ^ appends to, removes from or moves to the front of them. Other
+// options are left to IgnoredOptions.
+func applyOptions(cfg *ssh.ClientConfig, opts []string) {
+	defaults := ssh.SupportedAlgorithms()
+	for _, opt := range opts {
+		key, value, _ := strings.Cut(opt, "=")
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "kexalgorithms":
+			cfg.KeyExchanges = algorithmList(defaults.KeyExchanges, value)
+		case "ciphers":
+			cfg.Ciphers = algorithmList(defaults.Ciphers, value)
+		case "macs":
+			cfg.MACs = algorithmList(defaults.MACs, value)
+		case "hostkeyalgorithms":
+			cfg.HostKeyAlgorithms = algorithmList(defaults.HostKeys, value)
+		}
+	}
+}
+
+// algorithmList applies an OpenSSH algorithm list to defaults.
+func algorithmList(defaults []string, value string) []string {
+	if value == "" {
+		return defaults
+	}
+	op, list := value[0], strings.Split(value[1:], ",")
+	switch op {
+	case '+':
+		return append(slices.Clone(defaults), list...)
+	case '^':
+		return append(list, slices.DeleteFunc(slices.Clone(defaults), func(a string) bool {
+			return slices.Contains(list, a)
+		})...)
+	case '-':
+		// Removals may use wildcards, as in OpenSSH.
+		return slices.DeleteFunc(slices.Clone(defaults), func(a string) bool {
+			return slices.ContainsFunc(list, func(pattern string) bool {
+				ok, _ := path.Match(pattern, a)
+				return ok
+			})
+		})
+	}
+	return strings.Split(value, ",")
+}
+
+// IgnoredOptions returns the keys of the ssh -o options the built-in client
+// has no equivalent for.
+func IgnoredOptions(opts []string) []string {
+	var ignored []string
+	for _, opt := range opts {
+		key, _, _ := strings.Cut(opt, "=")
+		key = strings.TrimSpace(key)
+		switch strings.ToLower(key) {
+		case "kexalgorithms", "ciphers", "macs", "hostkeyalgorithms":
+		default:
+			ignored = append(ignored, key)
+		}
+	}
+	return ignored
+}
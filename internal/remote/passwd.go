@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	oldPasswordPrompt = regexp.MustCompile(`(?i)(current|old|\(current\)).*password[^:]*:\s*$`)
+	newPasswordPrompt = regexp.MustCompile(`(?i)(new|retype|re-enter|again).*password[^:]*:\s*$|password again:\s*$`)
+)
+
+// ChangePasswordPasswd changes the login user's password by driving
+// passwd(1) in a pty, answering its prompts with the old and new password.
+func ChangePasswordPasswd(client *ssh.Client, oldPass, newPass string, timeout time.Duration) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("opening session: %w", err)
+	}
+	defer session.Close()
+
+	if err := session.RequestPty("dumb", 24, 200, ssh.TerminalModes{ssh.ECHO: 0}); err != nil {
+		return fmt.Errorf("requesting pty: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out := &promptBuffer{changed: make(chan struct{}, 1)}
+	session.Stdout = out
+	session.Stderr = out
+
+	if err := session.Start("LC_ALL=C passwd"); err != nil {
+		return fmt.Errorf("starting passwd: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	deadline := time.After(timeout)
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("passwd failed: %s", out.summary())
+			}
+			return nil
+		case <-deadline:
+			return fmt.Errorf("passwd timed out: %s", out.summary())
+		case <-out.changed:
+			switch prompt := out.takePrompt(); {
+			case prompt == "":
+			case oldPasswordPrompt.MatchString(prompt):
+				fmt.Fprintf(stdin, "%s\n", oldPass)
+			case newPasswordPrompt.MatchString(prompt):
+				fmt.Fprintf(stdin, "%s\n", newPass)
+			}
+		}
+	}
+}
+
+// ChangePasswordChpasswd sets user's password with chpasswd(8), which
+// needs the login user to be root.
+func ChangePasswordChpasswd(client *ssh.Client, user, newPass string) error {
+	var stderr bytes.Buffer
+	code, err := Run(client, "chpasswd", strings.NewReader(user+":"+newPass+"\n"), &stderr, &stderr)
+	if err != nil {
+		return fmt.Errorf("running chpasswd: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("chpasswd exited with status %d: %s", code, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// promptBuffer collects session output and hands out the text after the
+// last answered prompt once it looks like a new prompt.
+type promptBuffer struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	offset  int
+	changed chan struct{}
+}
+
+func (b *promptBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	b.buf.Write(p)
+	b.mu.Unlock()
+	select {
+	case b.changed <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// takePrompt returns the unanswered output if it ends like a prompt and
+// marks it answered; otherwise it returns "".
+func (b *promptBuffer) takePrompt() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pending := b.buf.String()[b.offset:]
+	if !strings.HasSuffix(strings.TrimRight(pending, " "), ":") {
+		return ""
+	}
+	b.offset = b.buf.Len()
+	return pending
+}
+
+// summary returns the last line of output, for error messages. passwd
+// never echoes the passwords since echo is off in the pty.
+func (b *promptBuffer) summary() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := strings.Split(strings.TrimSpace(b.buf.String()), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if last == "" {
+		return "no output"
+	}
+	return last
+}
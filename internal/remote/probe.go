@@ -0,0 +1,150 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"tele/internal/store"
+)
+
+// Host key states reported by Probe.
+const (
+	HostKeyMatch    = "match"
+	HostKeyMismatch = "mismatch"
+	HostKeyUnpinned = "unpinned"
+)
+
+// Authentication states reported by Probe.
+const (
+	AuthOK      = "ok"
+	AuthFailed  = "failed"
+	AuthSkipped = "skipped"
+)
+
+// ProbeResult is the outcome of a health check against one destination.
+type ProbeResult struct {
+	Reachable    bool
+	TCPLatency   time.Duration
+	Banner       string
+	HostKey      string
+	PresentedKey string
+	Auth         string
+	AuthLatency  time.Duration
+	Err          error
+}
+
+// Probe connects to a destination and reports how far it got: TCP connect,
+// the server's version banner, the host key against its pin and, if
+// there are credentials, whether they still authenticate. The
+// credentials are never offered to a server whose host key does not match.
+func Probe(d *store.Destination, creds Credentials, timeout time.Duration) ProbeResult {
+	return ProbeVia(nil, d, creds, timeout)
+}
+
+// ProbeVia is Probe through a connection to a jump host, or directly if
+// jump is nil. The TCP latency is then that of the tunnelled connect.
+func ProbeVia(jump *ssh.Client, d *store.Destination, creds Credentials, timeout time.Duration) ProbeResult {
+	var res ProbeResult
+
+	start := time.Now()
+	var conn net.Conn
+	var err error
+	if jump != nil {
+		conn, err = jump.Dial("tcp", Addr(d))
+	} else {
+		conn, err = net.DialTimeout("tcp", Addr(d), timeout)
+	}
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer conn.Close()
+	res.Reachable = true
+	res.TCPLatency = time.Since(start)
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	bc := &bannerConn{Conn: conn}
+	cfg := &ssh.ClientConfig{
+		User:    d.User,
+		Timeout: timeout,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			res.PresentedKey = FormatHostKey(key)
+			switch {
+			case d.HostKey == "":
+				res.HostKey = HostKeyUnpinned
+			case d.HostKey == res.PresentedKey:
+				res.HostKey = HostKeyMatch
+			default:
+				res.HostKey = HostKeyMismatch
+				return &HostKeyMismatchError{Pinned: d.HostKey, Presented: res.PresentedKey}
+			}
+			return nil
+		},
+	}
+	applyOptions(cfg, d.SSHOptions)
+	if !creds.Empty() {
+		cfg.Auth = ClientConfig(d, creds, timeout).Auth
+	}
+
+	authStart := time.Now()
+	c, chans, reqs, err := ssh.NewClientConn(bc, Addr(d), cfg)
+	res.Banner = bc.banner()
+	if err == nil {
+		ssh.NewClient(c, chans, reqs).Close()
+	}
+
+	var mismatch *HostKeyMismatchError
+	switch {
+	case errors.As(err, &mismatch):
+		res.Auth = AuthSkipped
+		res.Err = err
+	case creds.Empty():
+		// With no auth methods the handshake always ends in an auth error
+		// once the host key has been seen, which is all that was asked for.
+		res.Auth = AuthSkipped
+		if res.HostKey == "" {
+			res.Err = err
+		}
+	case err == nil:
+		res.Auth = AuthOK
+		res.AuthLatency = time.Since(authStart)
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		res.Auth = AuthFailed
+		res.AuthLatency = time.Since(authStart)
+	default:
+		res.Err = err
+	}
+	return res
+}
+
+// bannerConn remembers the first line the server sends, its SSH version banner.
+type bannerConn struct {
+	net.Conn
+	buf  bytes.Buffer
+	done bool
+}
+
+func (c *bannerConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if !c.done && n > 0 {
+		c.buf.Write(p[:n])
+		if bytes.IndexByte(c.buf.Bytes(), '\n') >= 0 || c.buf.Len() > 255 {
+			c.done = true
+		}
+	}
+	return n, err
+}
+
+func (c *bannerConn) banner() string {
+	line, _, _ := bytes.Cut(c.buf.Bytes(), []byte("\n"))
+	line = bytes.TrimRight(line, "\r")
+	if !bytes.HasPrefix(line, []byte("SSH-")) {
+		return ""
+	}
+	return string(line)
+}
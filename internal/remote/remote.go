@@ -0,0 +1,265 @@
+package remote
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"tele/internal/ca"
+	"tele/internal/store"
+	"tele/internal/totp"
+)
+
+// DefaultTimeout bounds the TCP connect and SSH handshake.
+const DefaultTimeout = 10 * time.Second
+
+// Addr returns the host:port address of a destination.
+func Addr(d *store.Destination) string {
+	port := d.Port
+	if port == "" {
+		port = "22"
+	}
+	return net.JoinHostPort(d.Host, port)
+}
+
+// Credentials are the decrypted secrets used to log in to a destination.
+type Credentials struct {
+	Password string
+	// TOTP, when set, answers verification code prompts.
+	TOTP *totp.Key
+	// Certificate, when set, issues a user certificate to log in with,
+	// tried before the password.
+	Certificate func() (*ca.Issued, error) `json:"-"`
+	// Identity, when set, is a private key to log in with.
+	Identity crypto.PrivateKey `json:"-"`
+	// Jump, when set, is the host connections are tunnelled through.
+	Jump *Hop `json:"-"`
+}
+
+// Hop is a jump host: another destination and the credentials for it.
+type Hop struct {
+	Name  string
+	Dest  *store.Destination
+	Creds Credentials
+}
+
+// Empty reports whether there is nothing to log in with.
+func (c Credentials) Empty() bool {
+	return c.Password == "" && c.Certificate == nil && c.Identity == nil
+}
+
+var (
+	passwordPrompt = regexp.MustCompile(`(?i)passw(or)?d|passphrase`)
+	codePrompt     = regexp.MustCompile(`(?i)code|token|otp|one[- ]time|verification|authenticator|2fa|two[- ]factor|mfa`)
+)
+
+// ClientConfig builds an SSH client config that authenticates with a
+// private key, a freshly issued certificate or the destination's password,
+// answering keyboard-interactive prompts with the password or a fresh TOTP
+// code depending on what they ask for. The algorithm options among d's SSH
+// options apply as they would to OpenSSH.
+func ClientConfig(d *store.Destination, creds Credentials, timeout time.Duration) *ssh.ClientConfig {
+	var auth []ssh.AuthMethod
+	if creds.Identity != nil {
+		auth = append(auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signer, err := ssh.NewSignerFromKey(creds.Identity)
+			if err != nil {
+				return nil, err
+			}
+			return []ssh.Signer{signer}, nil
+		}))
+	}
+	if creds.Certificate != nil {
+		auth = append(auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			issued, err := creds.Certificate()
+			if err != nil {
+				return nil, err
+			}
+			signer, err := issued.Signer()
+			if err != nil {
+				return nil, err
+			}
+			return []ssh.Signer{signer}, nil
+		}))
+	}
+	if creds.Password != "" {
+		auth = append(auth, ssh.Password(creds.Password))
+	}
+	auth = append(auth, ssh.KeyboardInteractive(creds.answer))
+	cfg := &ssh.ClientConfig{
+		User:            d.User,
+		Auth:            auth,
+		HostKeyCallback: PinnedHostKey(d),
+		Timeout:         timeout,
+	}
+	applyOptions(cfg, d.SSHOptions)
+	return cfg
+}
+
+// answer responds to a keyboard-interactive challenge. Prompts that are
+// neither clearly a password nor clearly a code get the password, which is
+// what servers without 2FA ask for.
+func (c Credentials) answer(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	answers := make([]string, len(questions))
+	for i, q := range questions {
+		if codePrompt.MatchString(q) && !passwordPrompt.MatchString(q) {
+			if c.TOTP == nil {
+				return nil, fmt.Errorf("server asked %q but no TOTP secret is stored; add one with 'tele edit'", strings.TrimSpace(q))
+			}
+			answers[i] = c.TOTP.Next()
+			continue
+		}
+		answers[i] = c.Password
+	}
+	return answers, nil
+}
+
+// HostKeyMismatchError is returned when a server presents a host key other
+// than the one pinned for its destination.
+type HostKeyMismatchError struct {
+	Pinned    string
+	Presented string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key mismatch: pinned %s, server presented %s",
+		Fingerprint(e.Pinned), Fingerprint(e.Presented))
+}
+
+// FormatHostKey renders a public key in authorized_keys form, as stored in
+// Destination.HostKey.
+func FormatHostKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// Fingerprint returns the SHA256 fingerprint of a key in authorized_keys form.
+func Fingerprint(hostKey string) string {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return "(invalid key)"
+	}
+	return ssh.FingerprintSHA256(key)
+}
+
+// PinnedHostKey returns a callback that enforces the destination's pinned
+// host key. When none is pinned yet the presented key is trusted and pinned
+// on d; callers save d to make the pin permanent.
+func PinnedHostKey(d *store.Destination) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented := FormatHostKey(key)
+		if d.HostKey == "" {
+			d.HostKey = presented
+			return nil
+		}
+		if d.HostKey != presented {
+			return &HostKeyMismatchError{Pinned: d.HostKey, Presented: presented}
+		}
+		return nil
+	}
+}
+
+// Dial opens an authenticated SSH connection to a destination.
+func Dial(d *store.Destination, creds Credentials, timeout time.Duration) (*ssh.Client, error) {
+	client, err := ssh.Dial("tcp", Addr(d), ClientConfig(d, creds, timeout))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", Addr(d), err)
+	}
+	return client, nil
+}
+
+// DialVia opens an authenticated SSH connection to a destination tunnelled
+// through jump, an established connection to a jump host. Closing the
+// returned client closes jump too.
+func DialVia(jump *ssh.Client, d *store.Destination, creds Credentials, timeout time.Duration) (*ssh.Client, error) {
+	conn, err := jump.Dial("tcp", Addr(d))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s through jump host: %w", Addr(d), err)
+	}
+	conn = tunnelConn{conn, tunnelAddr(Addr(d))}
+	c, chans, reqs, err := ssh.NewClientConn(conn, Addr(d), ClientConfig(d, creds, timeout))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connecting to %s: %w", Addr(d), err)
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	go func() {
+		client.Wait()
+		jump.Close()
+	}()
+	return client, nil
+}
+
+// tunnelConn is a connection forwarded by a jump host. Its remote address
+// is the destination's, not the zero address the channel reports.
+type tunnelConn struct {
+	net.Conn
+	raddr net.Addr
+}
+
+func (c tunnelConn) RemoteAddr() net.Addr { return c.raddr }
+
+// tunnelAddr is a host:port that may only resolve on the jump host.
+type tunnelAddr string
+
+func (a tunnelAddr) Network() string { return "tcp" }
+func (a tunnelAddr) String() string  { return string(a) }
+
+// Run executes a command in a new session and returns its exit status.
+// A non-nil error means the command could not be run or did not report a status.
+func Run(client *ssh.Client, command string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, fmt.Errorf("opening session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	err = session.Run(command)
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// Quote single-quotes s for a POSIX shell.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// StartupCommand builds the remote command that applies a destination's
+// environment, working directory and startup command before handing over to
+// an interactive program. It returns "" when none of them are set, meaning
+// a plain login shell.
+func StartupCommand(d *store.Destination) string {
+	if len(d.Env) == 0 && d.RemoteDir == "" && d.RemoteCommand == "" {
+		return ""
+	}
+	var parts []string
+	for _, k := range store.SortedKeys(d.Env) {
+		parts = append(parts, "export "+k+"="+Quote(d.Env[k]))
+	}
+	if d.RemoteDir != "" {
+		parts = append(parts, "cd "+Quote(d.RemoteDir))
+	}
+	if d.RemoteCommand != "" {
+		// The startup command is shell syntax the user typed, so it is not quoted.
+		parts = append(parts, "exec "+d.RemoteCommand)
+	} else {
+		parts = append(parts, `exec "${SHELL:-/bin/sh}" -l`)
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,185 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// ShellOptions configures an interactive session.
+type ShellOptions struct {
+	// Output receives a copy of everything the remote side prints.
+	Output io.Writer
+	// OnResize is called after the local terminal changes size.
+	OnResize func(width, height int)
+	// Command, if set, runs in the pty instead of the login shell.
+	Command string
+	// SudoPassword, if set, is typed in answer to sudo's password prompt
+	// on this host, and masked in the copy sent to Output.
+	SudoPassword string
+}
+
+// TermSize returns the size of the local terminal, or 80x24 if stdout is not one.
+func TermSize() (width, height int) {
+	w, h, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || w == 0 || h == 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+var (
+	inputOnce sync.Once
+	input     chan []byte
+)
+
+// localInput returns a channel of chunks read from stdin. A single reader
+// goroutine serves every session, so a session that ends (for example on a
+// dropped connection) cannot swallow keystrokes meant for the next one.
+func localInput() <-chan []byte {
+	inputOnce.Do(func() {
+		input = make(chan []byte)
+		go func() {
+			defer close(input)
+			for {
+				buf := make([]byte, 4096)
+				n, err := os.Stdin.Read(buf)
+				if n > 0 {
+					input <- buf[:n]
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
+	return input
+}
+
+// forwardInput copies local input to a session until done is closed.
+func forwardInput(w io.WriteCloser, done <-chan struct{}) {
+	in := localInput()
+	for {
+		select {
+		case b, ok := <-in:
+			if !ok {
+				w.Close()
+				return
+			}
+			if _, err := w.Write(b); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Shell runs an interactive login shell on client, attached to the local
+// terminal, and returns the remote exit status.
+func Shell(client *ssh.Client, opts ShellOptions) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, fmt.Errorf("opening session: %w", err)
+	}
+	defer session.Close()
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return -1, fmt.Errorf("setting raw mode: %w", err)
+		}
+		defer term.Restore(fd, state)
+	}
+
+	width, height := TermSize()
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty(termType, height, width, modes); err != nil {
+		return -1, fmt.Errorf("requesting pty: %w", err)
+	}
+
+	pipe, err := session.StdinPipe()
+	if err != nil {
+		return -1, err
+	}
+	stdin := &lockedWriter{w: pipe}
+
+	outputs := []io.Writer{os.Stdout}
+	if opts.Output != nil {
+		redacted := NewRedactor(opts.Output, opts.SudoPassword)
+		defer redacted.Flush()
+		outputs = append(outputs, redacted)
+	}
+	// With a pty the remote side merges stderr into stdout, so one writer
+	// sees everything in order.
+	output := io.MultiWriter(outputs...)
+	command := opts.Command
+	if opts.SudoPassword != "" {
+		watcher, err := NewSudoWatcher(opts.SudoPassword, output, stdin, os.Stderr)
+		if err != nil {
+			return -1, err
+		}
+		defer watcher.Flush()
+		output = watcher
+		command = watcher.Command(command)
+	}
+	session.Stdout = output
+	session.Stderr = output
+	done := make(chan struct{})
+	defer close(done)
+	go forwardInput(stdin, done)
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer func() {
+		signal.Stop(winch)
+		close(winch)
+	}()
+	go func() {
+		for range winch {
+			w, h := TermSize()
+			session.WindowChange(h, w)
+			if opts.OnResize != nil {
+				opts.OnResize(w, h)
+			}
+		}
+	}()
+
+	if command != "" {
+		err = session.Start(command)
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		return -1, fmt.Errorf("starting shell: %w", err)
+	}
+	err = session.Wait()
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	var missing *ssh.ExitMissingError
+	if errors.As(err, &missing) {
+		return -1, fmt.Errorf("connection closed without an exit status")
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
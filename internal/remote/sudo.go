@@ -0,0 +1,269 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sudoRejected matches the messages sudo prints after a wrong password.
+var sudoRejected = regexp.MustCompile(`(?i)sorry, try again|incorrect password`)
+
+// sudoVerdict is how long after the password is typed a rejection is
+// looked for.
+const sudoVerdict = 5 * time.Second
+
+// SudoWatcher answers sudo's password prompt in an interactive session.
+// The session's shell gets a SUDO_PROMPT that starts with a random marker
+// (see Command), so only sudo run on this host from this session prompts
+// with it: sudo or su on a host reached from the session, and text that
+// merely looks like a prompt, are left alone. The watcher strips the
+// marker from the output and types the password once per session; later
+// prompts, including the retry after a rejected password, are left to the
+// user.
+type SudoWatcher struct {
+	password string
+	stdin    io.Writer
+	notice   io.Writer
+	// env is the marker as set in SUDO_PROMPT. sudo collapses its %% into
+	// the % of the marker it prints, so printing the variable, as env
+	// does, shows something else.
+	env string
+
+	mu       sync.Mutex
+	out      *markerWriter
+	answered time.Time
+	verdict  []byte // output since answering, until sudoVerdict passes
+}
+
+// NewSudoWatcher returns a watcher that passes output on to out and
+// answers the prompt by writing password to stdin. notice receives a
+// message if it is rejected.
+func NewSudoWatcher(password string, out, stdin, notice io.Writer) (*SudoWatcher, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(b)
+	w := &SudoWatcher{password: password, stdin: stdin, notice: notice, env: "[tele%%" + id + "]"}
+	w.out = &markerWriter{w: out, marker: []byte("[tele%" + id + "]"), onMarker: w.prompted}
+	return w, nil
+}
+
+// Command returns command, or a login shell if it is empty, run with
+// SUDO_PROMPT set to the marker followed by sudo's usual prompt.
+func (w *SudoWatcher) Command(command string) string {
+	if command == "" {
+		command = `exec "${SHELL:-/bin/sh}" -l`
+	}
+	return "export SUDO_PROMPT=" + Quote(w.env+"[sudo] password for %p: ") + "; " + command
+}
+
+// Write passes output on without the marker. It fails only if the
+// underlying writer does.
+func (w *SudoWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.verdict != nil {
+		w.verdict = append(w.verdict, p...)
+		switch {
+		case sudoRejected.Match(w.verdict):
+			w.verdict = nil
+			fmt.Fprint(w.notice, "\r\n[tele] the stored password was rejected; answer the prompt yourself.\r\n")
+		case time.Since(w.answered) > sudoVerdict || len(w.verdict) > 512:
+			w.verdict = nil
+		}
+	}
+	return w.out.Write(p)
+}
+
+// Flush writes any output held back as a possible start of the marker.
+func (w *SudoWatcher) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.out.Flush()
+}
+
+// prompted is called with the lock held each time sudo prompts.
+func (w *SudoWatcher) prompted(n int) {
+	if n != 1 {
+		return
+	}
+	w.answered = time.Now()
+	w.verdict = []byte{}
+	// Write from another goroutine: output delivery takes the lock, and
+	// the remote may not read its input until its output is read.
+	go io.WriteString(w.stdin, w.password+"\n")
+}
+
+// Redactor replaces every occurrence of a secret in what it writes with
+// asterisks. Output that could be the start of the secret is held back
+// until it is ruled out or Flush is called.
+type Redactor struct {
+	w      io.Writer
+	secret []byte
+	buf    []byte
+}
+
+// NewRedactor returns a Redactor writing to w. An empty secret disables it.
+func NewRedactor(w io.Writer, secret string) *Redactor {
+	return &Redactor{w: w, secret: []byte(secret)}
+}
+
+func (r *Redactor) Write(p []byte) (int, error) {
+	if len(r.secret) == 0 {
+		return r.w.Write(p)
+	}
+	r.buf = append(r.buf, p...)
+	r.buf = bytes.ReplaceAll(r.buf, r.secret, []byte("********"))
+	keep := 0
+	for n := min(len(r.secret)-1, len(r.buf)); n > 0; n-- {
+		if bytes.HasSuffix(r.buf, r.secret[:n]) {
+			keep = n
+			break
+		}
+	}
+	out := r.buf[:len(r.buf)-keep]
+	if len(out) > 0 {
+		if _, err := r.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	r.buf = append(r.buf[:0], r.buf[len(r.buf)-keep:]...)
+	return len(p), nil
+}
+
+// Flush writes any output held back.
+func (r *Redactor) Flush() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(r.buf)
+	r.buf = r.buf[:0]
+	return err
+}
+
+// RunSudo runs command as root through sudo, answering its password prompt
+// with password at most once. The command's own stdin is /dev/null, so the
+// password can never reach it, even when sudo does not ask for one.
+func RunSudo(client *ssh.Client, command, password string, stdout, stderr io.Writer) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, fmt.Errorf("opening session: %w", err)
+	}
+	defer session.Close()
+
+	marker, err := sudoMarker()
+	if err != nil {
+		return -1, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return -1, err
+	}
+	defer stdin.Close()
+	prompts := &markerWriter{w: stderr, marker: []byte(marker), onMarker: func(n int) {
+		if n == 1 {
+			io.WriteString(stdin, password+"\n")
+			return
+		}
+		// Rejected: end sudo's input rather than retry.
+		stdin.Close()
+	}}
+	session.Stdout = stdout
+	session.Stderr = prompts
+
+	wrapped := "exec </dev/null; " + command
+	err = session.Run("sudo -S -p " + Quote(marker) + " -- sh -c " + Quote(wrapped))
+	prompts.Flush()
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// sudoMarker returns a prompt string no real output will contain.
+func sudoMarker() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "[tele-sudo-" + hex.EncodeToString(b) + "]", nil
+}
+
+// markerWriter removes a marker from a stream, calling onMarker with the
+// running count each time it is seen.
+type markerWriter struct {
+	w        io.Writer
+	marker   []byte
+	onMarker func(n int)
+	count    int
+	buf      []byte
+}
+
+func (m *markerWriter) Write(p []byte) (int, error) {
+	m.buf = append(m.buf, p...)
+	for {
+		i := bytes.Index(m.buf, m.marker)
+		if i < 0 {
+			break
+		}
+		if _, err := m.w.Write(m.buf[:i]); err != nil {
+			return 0, err
+		}
+		m.buf = m.buf[i+len(m.marker):]
+		m.count++
+		m.onMarker(m.count)
+	}
+	// Hold back a possible partial marker.
+	keep := 0
+	for n := min(len(m.marker)-1, len(m.buf)); n > 0; n-- {
+		if bytes.HasSuffix(m.buf, m.marker[:n]) {
+			keep = n
+			break
+		}
+	}
+	if out := m.buf[:len(m.buf)-keep]; len(out) > 0 {
+		if _, err := m.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	m.buf = append(m.buf[:0], m.buf[len(m.buf)-keep:]...)
+	return len(p), nil
+}
+
+// Flush writes any output held back.
+func (m *markerWriter) Flush() {
+	if len(m.buf) > 0 {
+		m.w.Write(m.buf)
+		m.buf = nil
+	}
+}
+
+// lockedWriter serializes writes from several goroutines.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+func (l *lockedWriter) Close() error {
+	return l.w.Close()
+}
@@ -0,0 +1,85 @@
+package remote
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the watcher's goroutine.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestSudoWatcher(t *testing.T) {
+	var out, notice bytes.Buffer
+	var stdin syncBuffer
+	w, err := NewSudoWatcher("s3cret", &out, &stdin, &notice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := w.Command("")
+	env, ok := strings.CutPrefix(command, "export SUDO_PROMPT=")
+	if !ok || !strings.HasSuffix(command, `; exec "${SHELL:-/bin/sh}" -l`) {
+		t.Fatalf("Command = %q", command)
+	}
+	env = strings.Trim(strings.Split(env, ";")[0], "'")
+	// What sudo prints for that SUDO_PROMPT.
+	prompt := strings.NewReplacer("%%", "%", "%p", "me").Replace(env)
+
+	typed := func() string {
+		time.Sleep(50 * time.Millisecond)
+		return stdin.String()
+	}
+
+	// Look-alikes: su's prompt, sudo's default one, as on another host
+	// reached from the session, and the variable itself printed by env.
+	w.Write([]byte("Password: "))
+	w.Write([]byte("\n[sudo] password for me: "))
+	w.Write([]byte("\nSUDO_PROMPT=" + env + "\n$ "))
+	if got := typed(); got != "" {
+		t.Fatalf("typed %q for a prompt without the marker", got)
+	}
+
+	// The marker split across writes.
+	w.Write([]byte("$ sudo true\r\n" + prompt[:5]))
+	w.Write([]byte(prompt[5:]))
+	if got := typed(); got != "s3cret\n" {
+		t.Fatalf("typed %q, want the password", got)
+	}
+	// Another sudo soon after is not a rejection.
+	w.Write([]byte("\r\n$ sudo true\r\n" + prompt))
+	if notice.Len() != 0 {
+		t.Errorf("notice for a second sudo: %q", notice.String())
+	}
+	w.Write([]byte("\r\nSorry, try again.\r\n" + prompt))
+	if !strings.Contains(notice.String(), "rejected") {
+		t.Errorf("no notice of the rejected password: %q", notice.String())
+	}
+	w.Write([]byte("\r\n$ sudo true\r\n" + prompt))
+	w.Flush()
+	if got := typed(); got != "s3cret\n" {
+		t.Errorf("typed %q, want the password only once", got)
+	}
+	if marker := prompt[:strings.Index(prompt, "]")+1]; strings.Contains(out.String(), marker) {
+		t.Errorf("the marker reached the output: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "$ sudo true\r\n[sudo] password for me: ") {
+		t.Errorf("sudo's prompt is missing from the output: %q", out.String())
+	}
+}
@@ -0,0 +1,107 @@
+package sessions
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// mobaSSH is the session type MobaXterm gives SSH bookmarks.
+const mobaSSH = "109"
+
+// Positions in the %-separated settings of an SSH bookmark.
+const (
+	mobaHost     = 1
+	mobaPort     = 2
+	mobaUser     = 3
+	mobaJumpHost = 8
+	mobaJumpPort = 9
+	mobaJumpUser = 10
+	mobaKeyFile  = 14
+)
+
+// ParseMobaXterm reads MobaXterm bookmarks, from an exported .mxtsessions
+// file or from MobaXterm.ini. Sessions other than SSH are skipped.
+func ParseMobaXterm(data []byte) ([]Session, error) {
+	text := decodeText(data)
+	var sessions []Session
+	inBookmarks := false
+	folder := ""
+	found := false
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section := strings.ToLower(line[1 : len(line)-1])
+			inBookmarks = section == "bookmarks" || strings.HasPrefix(section, "bookmarks_")
+			found = found || inBookmarks
+			folder = ""
+			continue
+		}
+		if !inBookmarks {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "SubRep":
+			folder = strings.ReplaceAll(value, `\`, "/")
+			continue
+		case "ImgNum":
+			continue
+		}
+		if s, ok := mobaSession(key, value); ok {
+			s.Folder = folder
+			sessions = append(sessions, s)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no MobaXterm bookmarks in the file")
+	}
+	return sessions, nil
+}
+
+// mobaSession parses a bookmark such as
+// "#109#0%host%22%user%%-1%-1%%jump%22%juser%0%0%0%C:\key.pem%...#MobaFont...".
+func mobaSession(name, value string) (Session, bool) {
+	parts := strings.Split(value, "#")
+	if len(parts) < 3 || parts[1] != mobaSSH {
+		return Session{}, false
+	}
+	f := strings.Split(parts[2], "%")
+	field := func(i int) string {
+		if i < len(f) {
+			return strings.TrimSpace(f[i])
+		}
+		return ""
+	}
+	s := Session{
+		Name:    name,
+		Host:    field(mobaHost),
+		Port:    field(mobaPort),
+		User:    field(mobaUser),
+		KeyFile: mobaPath(field(mobaKeyFile)),
+	}
+	if s.Host == "" {
+		return Session{}, false
+	}
+	if h := field(mobaJumpHost); h != "" {
+		s.Jump = &Jump{Host: h, Port: field(mobaJumpPort), User: field(mobaJumpUser)}
+	}
+	return s, true
+}
+
+// mobaPath undoes the placeholders MobaXterm writes in paths to keep them
+// portable. A path under the profile directory becomes one under ~.
+func mobaPath(p string) string {
+	if rest, ok := strings.CutPrefix(p, "_ProfileDir_"); ok {
+		return "~" + strings.ReplaceAll(rest, `\`, "/")
+	}
+	return strings.ReplaceAll(p, "_CurrentDrive_:", "")
+}
@@ -0,0 +1,119 @@
+package sessions
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const puttySessions = `\software\simontatham\putty\sessions\`
+
+// puttyProxySSH is PuTTY's ProxyMethod for an SSH jump host (PuTTY 0.77+).
+const puttyProxySSH = 6
+
+// ParsePuTTY reads a registry export of PuTTY's saved sessions, as made by
+// `reg export HKCU\Software\SimonTatham\PuTTY\Sessions putty.reg`. Sessions
+// using other protocols than SSH, and PuTTY's "Default Settings", are
+// skipped.
+func ParsePuTTY(data []byte) ([]Session, error) {
+	text := decodeText(data)
+	if !strings.HasPrefix(text, "Windows Registry Editor") && !strings.HasPrefix(text, "REGEDIT4") {
+		return nil, fmt.Errorf("not a registry export")
+	}
+
+	var sessions []Session
+	var name string
+	values := map[string]string{}
+	flush := func() {
+		if name == "" || name == "Default Settings" {
+			return
+		}
+		if s, ok := puttySession(name, values); ok {
+			sessions = append(sessions, s)
+		}
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			flush()
+			name, values = "", map[string]string{}
+			key := line[1 : len(line)-1]
+			i := strings.Index(strings.ToLower(key), puttySessions)
+			if i < 0 || strings.Contains(key[i+len(puttySessions):], `\`) {
+				continue
+			}
+			// Session names are URL-escaped, e.g. "web%20server".
+			n, err := url.PathUnescape(key[i+len(puttySessions):])
+			if err != nil {
+				n = key[i+len(puttySessions):]
+			}
+			name = n
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || name == "" {
+			continue
+		}
+		k, err := strconv.Unquote(k)
+		if err != nil {
+			continue
+		}
+		values[k] = regValue(v)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	if len(sessions) == 0 && !strings.Contains(strings.ToLower(text), puttySessions) {
+		return nil, fmt.Errorf("no PuTTY sessions in the export")
+	}
+	return sessions, nil
+}
+
+// regValue decodes a registry value: "string" or dword:hex.
+func regValue(v string) string {
+	if rest, ok := strings.CutPrefix(v, "dword:"); ok {
+		n, err := strconv.ParseUint(rest, 16, 32)
+		if err != nil {
+			return ""
+		}
+		return strconv.FormatUint(n, 10)
+	}
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		// Only backslashes and quotes are escaped in .reg strings.
+		return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(v[1 : len(v)-1])
+	}
+	return ""
+}
+
+func puttySession(name string, v map[string]string) (Session, bool) {
+	if p := v["Protocol"]; p != "" && p != "ssh" {
+		return Session{}, false
+	}
+	s := Session{
+		Name:    name,
+		Host:    v["HostName"],
+		Port:    v["PortNumber"],
+		User:    v["UserName"],
+		KeyFile: v["PublicKeyFile"],
+	}
+	// PuTTY accepts user@host in the host name field.
+	if u, h, ok := strings.Cut(s.Host, "@"); ok {
+		if s.User == "" {
+			s.User = u
+		}
+		s.Host = h
+	}
+	if s.Host == "" {
+		return Session{}, false
+	}
+	if v["ProxyMethod"] == strconv.Itoa(puttyProxySSH) && v["ProxyHost"] != "" {
+		s.Jump = &Jump{Host: v["ProxyHost"], Port: v["ProxyPort"], User: v["ProxyUsername"]}
+	}
+	return s, true
+}
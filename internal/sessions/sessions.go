@@ -0,0 +1,48 @@
+package sessions
+
+import (
+	"bytes"
+	"unicode/utf16"
+)
+
+// Session is an SSH session saved by another client. Empty fields were not
+// set in it.
+type Session struct {
+	Name string
+	// Folder is the folder the session was filed under, "/"-separated.
+	Folder  string
+	Host    string
+	Port    string
+	User    string
+	KeyFile string
+	// Jump is the SSH jump host the session goes through, if any.
+	Jump *Jump
+}
+
+// Jump is a jump host as another client stores it: an address, not a
+// tele destination.
+type Jump struct {
+	Host string
+	Port string
+	User string
+}
+
+// decodeText returns data as UTF-8. Windows tools such as regedit write
+// UTF-16 with a byte order mark.
+func decodeText(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return decodeUTF16(data[2:], func(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 })
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return decodeUTF16(data[2:], func(b []byte) uint16 { return uint16(b[1]) | uint16(b[0])<<8 })
+	}
+	return string(bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf}))
+}
+
+func decodeUTF16(data []byte, unit func([]byte) uint16) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, unit(data[i:i+2]))
+	}
+	return string(utf16.Decode(units))
+}
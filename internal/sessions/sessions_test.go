@@ -0,0 +1,81 @@
+package sessions
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		file  string
+		parse func([]byte) ([]Session, error)
+		want  []Session
+	}{
+		// putty.reg is UTF-16 with a byte order mark, as regedit writes it.
+		{"putty.reg", ParsePuTTY, []Session{
+			{Name: "bastion", Host: "203.0.113.10", Port: "22", User: "ops", KeyFile: `C:\Users\ops\.ssh\ops.ppk`},
+			{
+				Name: "db primary", Host: "10.0.2.20", Port: "2201", User: "admin",
+				Jump: &Jump{Host: "203.0.113.10", Port: "22", User: "ops"},
+			},
+			// An HTTP proxy (ProxyMethod 5) is not a jump host.
+			{Name: "quoted", Host: `host"name`},
+		}},
+		{"sessions.mxtsessions", ParseMobaXterm, []Session{
+			{Name: "bastion", Host: "203.0.113.10", Port: "22", User: "ops", KeyFile: "~/.ssh/ops.pem"},
+			{
+				Name: "db1", Folder: "Prod/DB", Host: "10.0.2.20", Port: "2222", User: "admin", KeyFile: `\keys\db.pem`,
+				Jump: &Jump{Host: "203.0.113.10", Port: "22", User: "ops"},
+			},
+		}},
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tc.parse(data)
+		if err != nil {
+			t.Errorf("%s: %v", tc.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:", tc.file)
+			for _, s := range got {
+				t.Errorf("  got  %+v (jump %+v)", s, s.Jump)
+			}
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", "not-putty.reg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		desc  string
+		parse func([]byte) ([]Session, error)
+		data  []byte
+	}{
+		{"a registry export without PuTTY sessions", ParsePuTTY, data},
+		{"a file that is not a registry export", ParsePuTTY, []byte("[Bookmarks]\n")},
+		{"a MobaXterm file without bookmarks", ParseMobaXterm, []byte("[Misc]\nFoo=bar\n")},
+	} {
+		if _, err := tc.parse(tc.data); err == nil {
+			t.Errorf("%s parsed", tc.desc)
+		}
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"UTF-8":     []byte("héllo"),
+		"UTF-8 BOM": append([]byte{0xef, 0xbb, 0xbf}, "héllo"...),
+		"UTF-16LE":  {0xff, 0xfe, 'h', 0, 0xe9, 0, 'l', 0, 'l', 0, 'o', 0},
+		"UTF-16BE":  {0xfe, 0xff, 0, 'h', 0, 0xe9, 0, 'l', 0, 'l', 0, 'o'},
+	} {
+		if got := decodeText(data); got != "héllo" {
+			t.Errorf("%s: decodeText = %q", name, got)
+		}
+	}
+}
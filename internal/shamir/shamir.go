@@ -0,0 +1,118 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Share is one part of a split secret: the x coordinate it was evaluated
+// at, and one byte of y per byte of the secret.
+type Share struct {
+	X byte
+	Y []byte
+}
+
+// Split divides secret into n shares, any threshold of which reconstruct
+// it. Each byte is the constant term of its own random polynomial of
+// degree threshold-1 over GF(256).
+func Split(secret []byte, n, threshold int) ([]Share, error) {
+	if threshold < 2 || threshold > n || n > 255 {
+		return nil, fmt.Errorf("need 2 <= threshold <= shares <= 255, got %d of %d", threshold, n)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{X: byte(i + 1), Y: make([]byte, len(secret))}
+	}
+	coeffs := make([]byte, threshold)
+	for b, s := range secret {
+		coeffs[0] = s
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			shares[i].Y[b] = evaluate(coeffs, shares[i].X)
+		}
+	}
+	clear(coeffs)
+	return shares, nil
+}
+
+// Combine reconstructs a secret from at least threshold of its shares by
+// Lagrange interpolation at zero. Too few shares give a wrong secret, not
+// an error.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("need at least two shares")
+	}
+	size := len(shares[0].Y)
+	seen := map[byte]bool{}
+	for _, s := range shares {
+		if s.X == 0 || seen[s.X] {
+			return nil, fmt.Errorf("duplicate or invalid share %d", s.X)
+		}
+		if len(s.Y) != size {
+			return nil, errors.New("shares are of different secrets")
+		}
+		seen[s.X] = true
+	}
+	secret := make([]byte, size)
+	for i, si := range shares {
+		// The Lagrange basis polynomial of share i, evaluated at zero.
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = mul(basis, div(sj.X, sj.X^si.X))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(si.Y[b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// evaluate computes the polynomial with the given coefficients at x.
+func evaluate(coeffs []byte, x byte) byte {
+	y := byte(0)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// GF(256) arithmetic with the AES polynomial x^8+x^4+x^3+x+1, through
+// logarithm tables over the generator 3.
+var expTable, logTable = tables()
+
+func tables() (exp [510]byte, log [256]byte) {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = x, x
+		log[x] = byte(i)
+		// Multiply by 3: x*2 reduced, plus x.
+		double := x << 1
+		if x&0x80 != 0 {
+			double ^= 0x1b
+		}
+		x ^= double
+	}
+	return exp, log
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
@@ -0,0 +1,132 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+// slowMul multiplies in GF(256) bit by bit, as a reference for the tables.
+func slowMul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func TestFieldArithmetic(t *testing.T) {
+	// FIPS-197 section 4.2.
+	if got := mul(0x57, 0x83); got != 0xc1 {
+		t.Errorf("mul(0x57, 0x83) = %#x, want 0xc1", got)
+	}
+	if got := mul(0x57, 0x13); got != 0xfe {
+		t.Errorf("mul(0x57, 0x13) = %#x, want 0xfe", got)
+	}
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			if got, want := mul(byte(a), byte(b)), slowMul(byte(a), byte(b)); got != want {
+				t.Fatalf("mul(%#x, %#x) = %#x, want %#x", a, b, got, want)
+			}
+			if b != 0 {
+				if got := mul(div(byte(a), byte(b)), byte(b)); got != byte(a) {
+					t.Fatalf("div(%#x, %#x) * %#x = %#x", a, b, b, got)
+				}
+			}
+		}
+	}
+}
+
+func TestCombineKnownShares(t *testing.T) {
+	// f(x) = 0x42 + 0x11x: f(1) = 0x53, f(2) = 0x42 ^ 0x22 = 0x60.
+	secret, err := Combine([]Share{{X: 1, Y: []byte{0x53}}, {X: 2, Y: []byte{0x60}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret, []byte{0x42}) {
+		t.Errorf("Combine = %x, want 42", secret)
+	}
+}
+
+// subsets calls fn with every subset of shares of size k.
+func subsets(shares []Share, k int, fn func([]Share)) {
+	var pick func(start int, chosen []Share)
+	pick = func(start int, chosen []Share) {
+		if len(chosen) == k {
+			fn(chosen)
+			return
+		}
+		for i := start; i < len(shares); i++ {
+			pick(i+1, append(chosen[:len(chosen):len(chosen)], shares[i]))
+		}
+	}
+	pick(0, nil)
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	for _, tc := range []struct{ n, threshold int }{{2, 2}, {3, 2}, {5, 3}, {6, 6}} {
+		shares, err := Split(secret, tc.n, tc.threshold)
+		if err != nil {
+			t.Fatalf("Split(%d, %d): %v", tc.n, tc.threshold, err)
+		}
+		if len(shares) != tc.n {
+			t.Fatalf("Split(%d, %d) made %d shares", tc.n, tc.threshold, len(shares))
+		}
+		for k := tc.threshold; k <= tc.n; k++ {
+			subsets(shares, k, func(some []Share) {
+				got, err := Combine(some)
+				if err != nil {
+					t.Fatalf("%d of %d: %v", k, tc.n, err)
+				}
+				if !bytes.Equal(got, secret) {
+					t.Errorf("%d of %d (threshold %d) gave %x", k, tc.n, tc.threshold, got)
+				}
+			})
+		}
+		// One share short of the threshold recovers something else.
+		if k := tc.threshold - 1; k >= 2 {
+			subsets(shares, k, func(some []Share) {
+				if got, _ := Combine(some); bytes.Equal(got, secret) {
+					t.Errorf("%d of %d recovered the secret below the threshold of %d", k, tc.n, tc.threshold)
+				}
+			})
+		}
+	}
+}
+
+func TestSplitRejects(t *testing.T) {
+	for _, tc := range []struct {
+		secret       []byte
+		n, threshold int
+	}{
+		{[]byte("s"), 3, 1},
+		{[]byte("s"), 2, 3},
+		{[]byte("s"), 256, 3},
+		{nil, 3, 2},
+	} {
+		if _, err := Split(tc.secret, tc.n, tc.threshold); err == nil {
+			t.Errorf("Split(%q, %d, %d) succeeded", tc.secret, tc.n, tc.threshold)
+		}
+	}
+}
+
+func TestCombineRejects(t *testing.T) {
+	for name, shares := range map[string][]Share{
+		"one share":  {{X: 1, Y: []byte{1}}},
+		"duplicate":  {{X: 1, Y: []byte{1}}, {X: 1, Y: []byte{2}}},
+		"zero x":     {{X: 0, Y: []byte{1}}, {X: 1, Y: []byte{2}}},
+		"mismatched": {{X: 1, Y: []byte{1}}, {X: 2, Y: []byte{1, 2}}},
+	} {
+		if _, err := Combine(shares); err == nil {
+			t.Errorf("%s: Combine succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxIncludeDepth matches OpenSSH's limit on nested Include directives.
+const maxIncludeDepth = 16
+
+// Option is one keyword and its arguments. Keywords are lower-cased.
+type Option struct {
+	Key   string
+	Value string
+}
+
+// Block is a Host section: the patterns it applies to and its options in
+// the order they appear. Options before the first Host line form a block
+// with the pattern "*".
+type Block struct {
+	Patterns []string
+	Options  []Option
+}
+
+// Config is a parsed ssh_config file with its includes expanded.
+type Config struct {
+	Blocks []*Block
+	// Warnings describe lines that were skipped.
+	Warnings []string
+}
+
+// Parse reads an ssh_config file. Relative Include paths are resolved
+// against ~/.ssh, as ssh does for user configuration files.
+func Parse(path string) (*Config, error) {
+	cfg := &Config{}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{cfg: cfg, sshDir: filepath.Join(home, ".ssh")}
+	p.block = &Block{Patterns: []string{"*"}}
+	cfg.Blocks = append(cfg.Blocks, p.block)
+	if err := p.parseFile(path, 0); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+type parser struct {
+	cfg    *Config
+	sshDir string
+	block  *Block
+	// skipping is set inside a Match block, whose options are ignored.
+	skipping bool
+}
+
+func (p *parser) warn(format string, args ...any) {
+	p.cfg.Warnings = append(p.cfg.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseFile(path string, depth int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		key, args, err := splitLine(sc.Text())
+		if err != nil {
+			p.warn("%s:%d: %v", path, lineNo, err)
+			continue
+		}
+		switch key {
+		case "":
+			continue
+		case "host":
+			p.block = &Block{Patterns: args}
+			p.cfg.Blocks = append(p.cfg.Blocks, p.block)
+			p.skipping = false
+		case "match":
+			p.warn("%s:%d: Match blocks are not supported; skipping until the next Host", path, lineNo)
+			p.skipping = true
+		case "include":
+			if p.skipping {
+				continue
+			}
+			if depth+1 >= maxIncludeDepth {
+				p.warn("%s:%d: Include nested too deeply", path, lineNo)
+				continue
+			}
+			for _, pattern := range args {
+				if err := p.include(pattern, depth+1); err != nil {
+					p.warn("%s:%d: %v", path, lineNo, err)
+				}
+			}
+		default:
+			if p.skipping {
+				continue
+			}
+			p.block.Options = append(p.block.Options, Option{Key: key, Value: strings.Join(args, " ")})
+		}
+	}
+	return sc.Err()
+}
+
+// include parses the files matching pattern. A Host line inside them does
+// not outlast the included file: the including block resumes afterwards.
+func (p *parser) include(pattern string, depth int) error {
+	pattern = expandTilde(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(p.sshDir, pattern)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("Include %s: %w", pattern, err)
+	}
+	outer, skipping := p.block, p.skipping
+	for _, path := range paths {
+		if err := p.parseFile(path, depth); err != nil {
+			return fmt.Errorf("Include %s: %w", path, err)
+		}
+	}
+	if p.block != outer {
+		p.block = &Block{Patterns: outer.Patterns}
+		p.cfg.Blocks = append(p.cfg.Blocks, p.block)
+	}
+	p.skipping = skipping
+	return nil
+}
+
+// splitLine splits a config line into its lower-cased keyword and
+// arguments, honouring double quotes and the "Key=Value" form. Blank lines
+// and comments give an empty keyword.
+func splitLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return "", nil, fmt.Errorf("%s has no value", line)
+	}
+	key := strings.ToLower(line[:i])
+	rest := strings.TrimLeft(line[i:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+
+	var args []string
+	var cur strings.Builder
+	inQuote, inArg := false, false
+	for _, r := range rest {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			inArg = true
+		case !inQuote && (r == ' ' || r == '\t'):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case !inQuote && r == '#' && !inArg:
+			// A comment after the arguments.
+			return key, args, nil
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inQuote {
+		return "", nil, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("%s has no value", key)
+	}
+	return key, args, nil
+}
+
+// IsPattern reports whether a Host pattern is a wildcard rather than a
+// host name.
+func IsPattern(s string) bool {
+	return strings.ContainsAny(s, "*?")
+}
+
+// Aliases returns the literal host names given on Host lines, in order,
+// and the wildcard patterns, which name no host of their own.
+func (c *Config) Aliases() (aliases, patterns []string) {
+	seen := map[string]bool{}
+	for _, b := range c.Blocks[1:] {
+		for _, p := range b.Patterns {
+			if seen[p] || strings.HasPrefix(p, "!") {
+				continue
+			}
+			seen[p] = true
+			if IsPattern(p) {
+				patterns = append(patterns, p)
+			} else {
+				aliases = append(aliases, p)
+			}
+		}
+	}
+	return aliases, patterns
+}
+
+// Resolve returns the options that apply to host. As in ssh, the first
+// value given for a keyword wins, across every block whose patterns match.
+func (c *Config) Resolve(host string) map[string]string {
+	opts := map[string]string{}
+	for _, b := range c.Blocks {
+		if !matches(b.Patterns, host) {
+			continue
+		}
+		for _, o := range b.Options {
+			if _, ok := opts[o.Key]; !ok {
+				opts[o.Key] = o.Value
+			}
+		}
+	}
+	return opts
+}
+
+// matches reports whether host matches at least one pattern and no negated
+// pattern.
+func matches(patterns []string, host string) bool {
+	matched := false
+	for _, p := range patterns {
+		if neg, ok := strings.CutPrefix(p, "!"); ok {
+			if globMatch(neg, host) {
+				return false
+			}
+			continue
+		}
+		if globMatch(p, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// globMatch matches ssh_config patterns, where * and ? are the only
+// special characters.
+func globMatch(pattern, s string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	ok, _ := regexp.MatchString(re.String(), strings.ToLower(s))
+	if !ok {
+		ok, _ = regexp.MatchString(re.String(), s)
+	}
+	return ok
+}
+
+// ExpandTokens replaces the % tokens ssh understands in HostName and
+// IdentityFile values, and a leading ~ with the home directory. Unknown
+// tokens are left alone.
+func ExpandTokens(s string, tokens map[byte]string) string {
+	s = expandTilde(s)
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if s[i] == '%' {
+			b.WriteByte('%')
+		} else if v, ok := tokens[s[i]]; ok {
+			b.WriteString(v)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func expandTilde(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
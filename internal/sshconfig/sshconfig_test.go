@@ -0,0 +1,160 @@
+package sshconfig
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setHome points the home directory at testdata, so that relative
+// Include paths resolve against testdata/.ssh.
+func setHome(t *testing.T) string {
+	t.Helper()
+	home, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+	return home
+}
+
+func parseFixture(t *testing.T) *Config {
+	t.Helper()
+	setHome(t)
+	cfg, err := Parse(filepath.Join("testdata", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestParse(t *testing.T) {
+	cfg := parseFixture(t)
+	want := []*Block{
+		{Patterns: []string{"*"}, Options: []Option{{"user", "default"}, {"serveraliveinterval", "30"}}},
+		{Patterns: []string{"web1", "web2"}, Options: []Option{{"hostname", "%h.example.com"}, {"port", "2200"}, {"identityfile", "~/.ssh/my key"}}},
+		{Patterns: []string{"extra"}, Options: []Option{{"hostname", "extra.example.com"}}},
+		// The including block resumes after the included file.
+		{Patterns: []string{"web1", "web2"}, Options: []Option{{"compression", "yes"}}},
+		{Patterns: []string{"*.prod", "!bastion.prod"}, Options: []Option{{"proxyjump", "bastion.prod"}}},
+		{Patterns: []string{"db"}, Options: []Option{{"port", "5432"}, {"user", "postgres"}}},
+		{Patterns: []string{"*"}, Options: []Option{{"user", "fallback"}}},
+	}
+	if len(cfg.Blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(cfg.Blocks), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(cfg.Blocks[i], want[i]) {
+			t.Errorf("block %d:\n got  %+v\n want %+v", i, cfg.Blocks[i], want[i])
+		}
+	}
+
+	if len(cfg.Warnings) != 2 || !strings.Contains(cfg.Warnings[0], "Match") || !strings.Contains(cfg.Warnings[1], "unterminated quote") {
+		t.Errorf("warnings = %q", cfg.Warnings)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	aliases, patterns := parseFixture(t).Aliases()
+	if want := []string{"web1", "web2", "extra", "db"}; !reflect.DeepEqual(aliases, want) {
+		t.Errorf("aliases = %q, want %q", aliases, want)
+	}
+	if want := []string{"*.prod", "*"}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("patterns = %q, want %q", patterns, want)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cfg := parseFixture(t)
+	for _, tc := range []struct {
+		host string
+		want map[string]string
+	}{
+		// The leading options come first, so they win over later blocks.
+		{"web2", map[string]string{
+			"user": "default", "serveraliveinterval": "30", "hostname": "%h.example.com",
+			"port": "2200", "identityfile": "~/.ssh/my key", "compression": "yes",
+		}},
+		{"extra", map[string]string{"user": "default", "serveraliveinterval": "30", "hostname": "extra.example.com"}},
+		{"API.prod", map[string]string{"user": "default", "serveraliveinterval": "30", "proxyjump": "bastion.prod"}},
+		{"bastion.prod", map[string]string{"user": "default", "serveraliveinterval": "30"}},
+		{"db", map[string]string{"user": "default", "serveraliveinterval": "30", "port": "5432"}},
+	} {
+		if got := cfg.Resolve(tc.host); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Resolve(%q) = %v, want %v", tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestExpandTokens(t *testing.T) {
+	home := setHome(t)
+	tokens := map[byte]string{'h': "db1.example.com", 'r': "admin"}
+	for in, want := range map[string]string{
+		"%h":                "db1.example.com",
+		"~/.ssh/%r@%h":      filepath.Join(home, ".ssh", "admin@db1.example.com"),
+		"/keys/~/%%h %x":    "/keys/~/%h %x",
+		"trailing%":         "trailing%",
+		"~other/id_ed25519": "~other/id_ed25519",
+		"~":                 home,
+	} {
+		if got := ExpandTokens(in, tokens); got != want {
+			t.Errorf("ExpandTokens(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var b strings.Builder
+	err := Write(&b, []string{"Written by tele."}, []Host{
+		{
+			Alias: "web1", Comment: "Servers/Web", HostName: "10.0.0.5", Port: "2200", User: "root",
+			ProxyJump: "bastion", IdentityFile: "/home/me/my key",
+			HostKeyAlias: "tele-web1", KnownHostsFile: "/home/me/known_hosts",
+			Options: []string{"ServerAliveInterval=30", "ProxyCommand nc %h %p"},
+		},
+		{Alias: "bastion", HostName: "203.0.113.10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Written by tele.
+
+Host web1
+    # Servers/Web
+    HostName 10.0.0.5
+    Port 2200
+    User root
+    ProxyJump bastion
+    IdentityFile "/home/me/my key"
+    IdentitiesOnly yes
+    HostKeyAlias tele-web1
+    UserKnownHostsFile /home/me/known_hosts
+    ServerAliveInterval 30
+    ProxyCommand nc %h %p
+
+Host bastion
+    HostName 203.0.113.10
+`
+	if b.String() != want {
+		t.Errorf("Write wrote:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestWriteRejectsControlCharacters(t *testing.T) {
+	for _, h := range []Host{
+		{Alias: "web", HostName: "10.0.0.5\n    ProxyCommand sh -c 'id >/tmp/pwned'"},
+		{Alias: "web", User: "root\r\nHost *"},
+		{Alias: "web", Port: "22\x00"},
+		{Alias: "web", Options: []string{"ServerAliveInterval=30\nLocalCommand id"}},
+		{Alias: "web", IdentityFile: "/keys/id\n"},
+	} {
+		var b strings.Builder
+		if err := Write(&b, nil, []Host{{Alias: "ok", HostName: "ok.example.com"}, h}); err == nil {
+			t.Errorf("Write(%+v) succeeded", h)
+		}
+		if b.Len() != 0 {
+			t.Errorf("Write(%+v) wrote %q before failing", h, b.String())
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Host is a Host block to write. Empty fields are left out.
+type Host struct {
+	Alias        string
+	Comment      string
+	HostName     string
+	Port         string
+	User         string
+	ProxyJump    string
+	IdentityFile string
+	// HostKeyAlias and KnownHostsFile point ssh at a pinned host key.
+	HostKeyAlias   string
+	KnownHostsFile string
+	// Options are further "Key=Value" or "Key Value" lines.
+	Options []string
+}
+
+// Validate reports a field that would not stay on its own line. ssh_config
+// has no escapes, so a newline in a value would add a directive of its own,
+// such as a ProxyCommand.
+func (h *Host) Validate() error {
+	fields := []struct{ name, value string }{
+		{"alias", h.Alias}, {"comment", h.Comment}, {"host name", h.HostName}, {"port", h.Port},
+		{"user", h.User}, {"jump host", h.ProxyJump}, {"identity file", h.IdentityFile},
+		{"host key alias", h.HostKeyAlias}, {"known hosts file", h.KnownHostsFile},
+	}
+	for _, o := range h.Options {
+		fields = append(fields, struct{ name, value string }{"option", o})
+	}
+	for _, f := range fields {
+		if strings.IndexFunc(f.value, func(r rune) bool { return r != '\t' && unicode.IsControl(r) }) >= 0 {
+			return fmt.Errorf("%s: %s %q contains a control character", h.Alias, f.name, f.value)
+		}
+	}
+	return nil
+}
+
+// Write writes a config file made of header, as comment lines, and a Host
+// block for each host. It writes nothing if a host does not validate.
+func Write(w io.Writer, header []string, hosts []Host) error {
+	for i := range hosts {
+		if err := hosts[i].Validate(); err != nil {
+			return err
+		}
+	}
+	bw := bufio.NewWriter(w)
+	for _, line := range header {
+		fmt.Fprintf(bw, "# %s\n", line)
+	}
+	for _, h := range hosts {
+		fmt.Fprintf(bw, "\nHost %s\n", h.Alias)
+		if h.Comment != "" {
+			fmt.Fprintf(bw, "    # %s\n", h.Comment)
+		}
+		option := func(key, value string) {
+			if value != "" {
+				fmt.Fprintf(bw, "    %s %s\n", key, value)
+			}
+		}
+		option("HostName", h.HostName)
+		option("Port", h.Port)
+		option("User", h.User)
+		option("ProxyJump", h.ProxyJump)
+		if h.IdentityFile != "" {
+			option("IdentityFile", quote(h.IdentityFile))
+			option("IdentitiesOnly", "yes")
+		}
+		option("HostKeyAlias", h.HostKeyAlias)
+		if h.KnownHostsFile != "" {
+			option("UserKnownHostsFile", quote(h.KnownHostsFile))
+		}
+		// Options are written as given: values such as ProxyCommand are
+		// taken verbatim by ssh.
+		for _, o := range h.Options {
+			key, value, ok := strings.Cut(o, "=")
+			if !ok {
+				key, value, _ = strings.Cut(o, " ")
+			}
+			option(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+	return bw.Flush()
+}
+
+// quote double-quotes paths containing spaces, as ssh_config requires.
+func quote(s string) string {
+	if !strings.ContainsAny(s, " \t") {
+		return s
+	}
+	return `"` + s + `"`
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"tele/internal/config"
+)
+
+// CA is tele's SSH certificate authority. The private key is encrypted
+// like a destination password.
+type CA struct {
+	PublicKey  string           `json:"public_key"`
+	PrivateKey *EncryptedSecret `json:"private_key"`
+	Created    time.Time        `json:"created"`
+}
+
+// ReadCA reads the certificate authority, returning nil if none was created.
+func ReadCA() (*CA, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "ca.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ca CA
+	if err := json.Unmarshal(data, &ca); err != nil {
+		return nil, err
+	}
+	return &ca, nil
+}
+
+// WriteCA saves the certificate authority.
+func WriteCA(ca *CA) error {
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ca, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "ca.json"), data, 0600)
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"tele/internal/config"
+)
+
+// Health is the cached result of the last `tele check` of a destination.
+type Health struct {
+	Name        string    `json:"name"`
+	Checked     time.Time `json:"checked"`
+	Reachable   bool      `json:"reachable"`
+	TCPLatency  float64   `json:"tcp_latency_ms"`
+	Banner      string    `json:"banner,omitempty"`
+	HostKey     string    `json:"host_key,omitempty"`
+	Auth        string    `json:"auth,omitempty"`
+	AuthLatency float64   `json:"auth_latency_ms,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Status summarizes a health result in a few words.
+func (h Health) Status() string {
+	switch {
+	case !h.Reachable:
+		return "unreachable"
+	case h.HostKey == "mismatch":
+		return "host key mismatch"
+	case h.Auth == "failed":
+		return "auth failed"
+	case h.Error != "":
+		return "error"
+	default:
+		return "ok"
+	}
+}
+
+// ReadHealth reads the health cache. A missing cache is empty, not an error.
+func ReadHealth() (map[string]Health, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "health.json"))
+	if os.IsNotExist(err) {
+		return map[string]Health{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	health := map[string]Health{}
+	if err := json.Unmarshal(data, &health); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
+
+// WriteHealth replaces the health cache.
+func WriteHealth(health map[string]Health) error {
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "health.json"), data, 0600)
+}
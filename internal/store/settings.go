@@ -0,0 +1,51 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"tele/internal/config"
+)
+
+// Settings holds configuration that applies to every destination.
+type Settings struct {
+	PreHook  string `json:"pre_hook,omitempty"`
+	PostHook string `json:"post_hook,omitempty"`
+	// MuxIdle, when set, makes connections start a shared master that
+	// exits after this long without clients, e.g. "10m".
+	MuxIdle string `json:"mux_idle,omitempty"`
+}
+
+// ReadSettings reads the global settings. A missing file means defaults.
+func ReadSettings() (*Settings, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "settings.json"))
+	if os.IsNotExist(err) {
+		return &Settings{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Settings
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// WriteSettings replaces the global settings.
+func WriteSettings(s *Settings) error {
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "settings.json"), data, 0600)
+}
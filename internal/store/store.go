@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"tele/internal/config"
 )
@@ -15,18 +17,83 @@ import (
 type MasterConfig struct {
 	Salt         string `json:"salt"`
 	PasswordHash string `json:"password_hash"`
+	// VaultKey, once set, is the random key every secret is encrypted
+	// under in place of the master password, encrypted under the master
+	// password. VaultKeyCheck is a hash of it, to recognise it when it is
+	// recovered by other means.
+	VaultKey      *EncryptedSecret `json:"vault_key,omitempty"`
+	VaultKeyCheck string           `json:"vault_key_check,omitempty"`
+	// PendingVaultKey is a new vault key, encrypted under the master
+	// password, while the vault's secrets are being moved under it.
+	PendingVaultKey *EncryptedSecret `json:"pending_vault_key,omitempty"`
+	// Recovery is the vault key encrypted under a one-time recovery code.
+	Recovery *EncryptedSecret `json:"recovery,omitempty"`
 }
 
 // Destination represents a destination JSON file on disk.
 type Destination struct {
-	Host              string `json:"host"`
-	Port              string `json:"port"`
-	User              string `json:"user"`
-	EncryptedPassword string `json:"encrypted_password"`
-	Nonce             string `json:"nonce"`
-	Salt              string `json:"salt"`
+	Host              string            `json:"host"`
+	Port              string            `json:"port"`
+	User              string            `json:"user"`
+	Auth              string            `json:"auth,omitempty"`
+	Principals        []string          `json:"principals,omitempty"`
+	IdentityFile      string            `json:"identity_file,omitempty"`
+	ProxyJump         string            `json:"proxy_jump,omitempty"`
+	EncryptedPassword string            `json:"encrypted_password"`
+	Nonce             string            `json:"nonce"`
+	Salt              string            `json:"salt"`
+	Tags              map[string]string `json:"tags,omitempty"`
+	Record            string            `json:"record,omitempty"`
+	SSHOptions        []string          `json:"ssh_options,omitempty"`
+	Env               map[string]string `json:"env,omitempty"`
+	RemoteDir         string            `json:"remote_dir,omitempty"`
+	RemoteCommand     string            `json:"remote_command,omitempty"`
+	AutoSudo          bool              `json:"auto_sudo,omitempty"`
+	PreHook           string            `json:"pre_hook,omitempty"`
+	PostHook          string            `json:"post_hook,omitempty"`
+	HostKey           string            `json:"host_key,omitempty"`
+	Pending           *PendingPassword  `json:"pending_password,omitempty"`
+	TOTP              *EncryptedSecret  `json:"totp,omitempty"`
+	// Keys is set in a team vault: the secrets above are then encrypted
+	// under a random data key, wrapped to each member, and have no salt.
+	Keys []WrappedKey `json:"keys,omitempty"`
+	// Modified is when the destination was last saved, for resolving
+	// conflicting edits made on different machines.
+	Modified time.Time `json:"modified,omitzero"`
 }
 
+// EncryptedSecret is a secret other than the password, such as a TOTP
+// seed, encrypted the same way under its own salt.
+type EncryptedSecret struct {
+	Ciphertext string `json:"ciphertext"`
+	Nonce      string `json:"nonce"`
+	Salt       string `json:"salt"`
+}
+
+// PendingPassword is a rotated password that has not been verified yet. It
+// is encrypted exactly like the current one and replaces it once a login
+// with it succeeds.
+type PendingPassword struct {
+	EncryptedPassword string    `json:"encrypted_password"`
+	Nonce             string    `json:"nonce"`
+	Salt              string    `json:"salt"`
+	Created           time.Time `json:"created"`
+}
+
+// Authentication methods for Destination.Auth.
+const (
+	AuthPassword    = ""
+	AuthCertificate = "cert"
+	AuthKey         = "key"
+)
+
+// Recording modes for Destination.Record.
+const (
+	RecordOff       = ""
+	RecordOn        = "on"
+	RecordEncrypted = "encrypted"
+)
+
 // MasterExists checks if master.json exists.
 func MasterExists() (bool, error) {
 	dir, err := config.Dir()
@@ -42,19 +109,45 @@ func MasterExists() (bool, error) {
 
 // WriteMaster writes the master config to disk.
 func WriteMaster(salt, passwordHash []byte) error {
+	return SaveMaster(&MasterConfig{
+		Salt:         hex.EncodeToString(salt),
+		PasswordHash: hex.EncodeToString(passwordHash),
+	})
+}
+
+// LoadMaster reads the whole master config from disk.
+func LoadMaster() (*MasterConfig, error) {
 	dir, err := config.Dir()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	mc := MasterConfig{
-		Salt:         hex.EncodeToString(salt),
-		PasswordHash: hex.EncodeToString(passwordHash),
+	data, err := os.ReadFile(filepath.Join(dir, "master.json"))
+	if err != nil {
+		return nil, err
+	}
+	var mc MasterConfig
+	if err := json.Unmarshal(data, &mc); err != nil {
+		return nil, err
+	}
+	return &mc, nil
+}
+
+// SaveMaster writes the whole master config to disk.
+func SaveMaster(mc *MasterConfig) error {
+	dir, err := config.Dir()
+	if err != nil {
+		return err
 	}
 	data, err := json.MarshalIndent(mc, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(dir, "master.json"), data, 0600)
+	// A torn master.json would lock every secret away.
+	path := filepath.Join(dir, "master.json")
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
 }
 
 // ReadMaster reads the master config from disk, returning salt and passwordHash as bytes.
@@ -82,20 +175,26 @@ func ReadMaster() (salt, passwordHash []byte, err error) {
 	return salt, passwordHash, nil
 }
 
-// WriteDestination saves a destination to disk.
-func WriteDestination(name string, host, port, user string, encPass, nonce, salt []byte) error {
+// ReadDestination reads a destination from disk.
+func ReadDestination(name string) (host, port, user string, encPass, nonce, salt []byte, err error) {
+	d, err := LoadDestination(name)
+	if err != nil {
+		return "", "", "", nil, nil, nil, err
+	}
+	encPass, nonce, salt, err = d.Ciphertext()
+	if err != nil {
+		return "", "", "", nil, nil, nil, err
+	}
+	return d.Host, d.Port, d.User, encPass, nonce, salt, nil
+}
+
+// SaveDestination writes a full destination record to disk.
+func SaveDestination(name string, d *Destination) error {
 	dir, err := config.DestinationsDir()
 	if err != nil {
 		return err
 	}
-	d := Destination{
-		Host:              host,
-		Port:              port,
-		User:              user,
-		EncryptedPassword: hex.EncodeToString(encPass),
-		Nonce:             hex.EncodeToString(nonce),
-		Salt:              hex.EncodeToString(salt),
-	}
+	d.Modified = time.Now().UTC().Truncate(time.Second)
 	data, err := json.MarshalIndent(d, "", "  ")
 	if err != nil {
 		return err
@@ -103,33 +202,145 @@ func WriteDestination(name string, host, port, user string, encPass, nonce, salt
 	return os.WriteFile(filepath.Join(dir, name+".json"), data, 0600)
 }
 
-// ReadDestination reads a destination from disk.
-func ReadDestination(name string) (host, port, user string, encPass, nonce, salt []byte, err error) {
+// LoadDestination reads a full destination record from disk.
+func LoadDestination(name string) (*Destination, error) {
 	dir, err := config.DestinationsDir()
 	if err != nil {
-		return "", "", "", nil, nil, nil, err
+		return nil, err
 	}
 	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
 	if err != nil {
-		return "", "", "", nil, nil, nil, err
+		return nil, err
 	}
 	var d Destination
 	if err := json.Unmarshal(data, &d); err != nil {
-		return "", "", "", nil, nil, nil, err
+		return nil, err
 	}
+	return &d, nil
+}
+
+// Ciphertext decodes the encrypted password, nonce and salt of a destination.
+func (d *Destination) Ciphertext() (encPass, nonce, salt []byte, err error) {
 	encPass, err = hex.DecodeString(d.EncryptedPassword)
 	if err != nil {
-		return "", "", "", nil, nil, nil, fmt.Errorf("decoding encrypted password: %w", err)
+		return nil, nil, nil, fmt.Errorf("decoding encrypted password: %w", err)
 	}
 	nonce, err = hex.DecodeString(d.Nonce)
 	if err != nil {
-		return "", "", "", nil, nil, nil, fmt.Errorf("decoding nonce: %w", err)
+		return nil, nil, nil, fmt.Errorf("decoding nonce: %w", err)
 	}
 	salt, err = hex.DecodeString(d.Salt)
 	if err != nil {
-		return "", "", "", nil, nil, nil, fmt.Errorf("decoding salt: %w", err)
+		return nil, nil, nil, fmt.Errorf("decoding salt: %w", err)
 	}
-	return d.Host, d.Port, d.User, encPass, nonce, salt, nil
+	return encPass, nonce, salt, nil
+}
+
+// SetCiphertext hex-encodes and stores the encrypted password, nonce and salt.
+func (d *Destination) SetCiphertext(encPass, nonce, salt []byte) {
+	d.EncryptedPassword = hex.EncodeToString(encPass)
+	d.Nonce = hex.EncodeToString(nonce)
+	d.Salt = hex.EncodeToString(salt)
+}
+
+// NewEncryptedSecret hex-encodes an encrypted secret, nonce and salt.
+func NewEncryptedSecret(ciphertext, nonce, salt []byte) *EncryptedSecret {
+	return &EncryptedSecret{
+		Ciphertext: hex.EncodeToString(ciphertext),
+		Nonce:      hex.EncodeToString(nonce),
+		Salt:       hex.EncodeToString(salt),
+	}
+}
+
+// Decode decodes the ciphertext, nonce and salt of an encrypted secret.
+func (s *EncryptedSecret) Decode() (ciphertext, nonce, salt []byte, err error) {
+	ciphertext, err = hex.DecodeString(s.Ciphertext)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("decoding ciphertext: %w", err)
+	}
+	nonce, err = hex.DecodeString(s.Nonce)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("decoding nonce: %w", err)
+	}
+	salt, err = hex.DecodeString(s.Salt)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("decoding salt: %w", err)
+	}
+	return ciphertext, nonce, salt, nil
+}
+
+// PromotePending makes the pending password the current one.
+func (d *Destination) PromotePending() {
+	if d.Pending == nil {
+		return
+	}
+	d.EncryptedPassword = d.Pending.EncryptedPassword
+	d.Nonce = d.Pending.Nonce
+	d.Salt = d.Pending.Salt
+	d.Pending = nil
+}
+
+// PendingDestination returns a copy of d whose current password is the
+// pending one, so it can be decrypted and dialed like any destination.
+func (d *Destination) PendingDestination() *Destination {
+	cp := *d
+	cp.PromotePending()
+	return &cp
+}
+
+// MatchTags reports whether the destination carries every filter.
+// A filter is either "key=value" or a bare "key" that only needs to be present.
+func (d *Destination) MatchTags(filters []string) bool {
+	for _, f := range filters {
+		key, value, hasValue := strings.Cut(f, "=")
+		got, ok := d.Tags[key]
+		if !ok || (hasValue && got != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParsePairs parses a comma-separated list of key=value pairs, as used for
+// tags and environment variables. It returns nil for an empty list.
+func ParsePairs(s string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected key=value", part)
+		}
+		pairs[key] = strings.TrimSpace(value)
+	}
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	return pairs, nil
+}
+
+// FormatPairs renders pairs as a sorted, comma-separated list of key=value entries.
+func FormatPairs(pairs map[string]string) string {
+	keys := SortedKeys(pairs)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + pairs[k]
+	}
+	return strings.Join(parts, ",")
+}
+
+// SortedKeys returns the keys of m in sorted order.
+func SortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // ListDestinations returns the names of all saved destinations.
@@ -144,7 +355,9 @@ func ListDestinations() ([]string, error) {
 	}
 	var names []string
 	for _, e := range entries {
-		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+		// Dotfiles, such as the sync repo's copy of master.json, are not
+		// destinations.
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") && !strings.HasPrefix(e.Name(), ".") {
 			names = append(names, strings.TrimSuffix(e.Name(), ".json"))
 		}
 	}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"tele/internal/config"
+)
+
+// Team lists the members of a team vault. It lives with the destinations,
+// so it is synced with them.
+type Team struct {
+	Members []Member `json:"members"`
+}
+
+// Member is someone a team vault's destinations are shared with.
+type Member struct {
+	Name      string    `json:"name"`
+	PublicKey string    `json:"public_key"`
+	Added     time.Time `json:"added"`
+}
+
+// Identity is this machine's X25519 key pair for team vaults. The private
+// key is encrypted like a destination password.
+type Identity struct {
+	PublicKey  string           `json:"public_key"`
+	PrivateKey *EncryptedSecret `json:"private_key"`
+	Created    time.Time        `json:"created"`
+}
+
+// WrappedKey is a destination's data key encrypted to one member's public
+// key.
+type WrappedKey struct {
+	Recipient  string `json:"recipient"`
+	Ephemeral  string `json:"ephemeral"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// ReadTeam reads the team vault's members, returning nil if the vault is
+// not a team vault.
+func ReadTeam() (*Team, error) {
+	dir, err := config.DestinationsDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".team.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var t Team
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// WriteTeam saves the team vault's members.
+func WriteTeam(t *Team) error {
+	dir, err := config.DestinationsDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ".team.json"), data, 0600)
+}
+
+// ReadIdentity reads this machine's identity, returning nil if none was
+// created.
+func ReadIdentity() (*Identity, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "identity.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var id Identity
+	if err := json.Unmarshal(data, &id); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// WriteIdentity saves this machine's identity.
+func WriteIdentity(id *Identity) error {
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "identity.json"), data, 0600)
+}
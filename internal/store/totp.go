@@ -0,0 +1,64 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"tele/internal/config"
+)
+
+var totpMu sync.Mutex
+
+// TOTPStep returns the last TOTP time step used to log in to a destination,
+// or 0 if none is recorded.
+func TOTPStep(name string) (int64, error) {
+	totpMu.Lock()
+	defer totpMu.Unlock()
+	steps, err := readTOTPSteps()
+	return steps[name], err
+}
+
+// RecordTOTPStep remembers that the code for step was sent to a
+// destination, so later runs wait for a fresh one.
+func RecordTOTPStep(name string, step int64) error {
+	totpMu.Lock()
+	defer totpMu.Unlock()
+	steps, err := readTOTPSteps()
+	if err != nil {
+		return err
+	}
+	if steps[name] >= step {
+		return nil
+	}
+	steps[name] = step
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(steps, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "totp_steps.json"), data, 0600)
+}
+
+func readTOTPSteps() (map[string]int64, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "totp_steps.json"))
+	if os.IsNotExist(err) {
+		return map[string]int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	steps := map[string]int64{}
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
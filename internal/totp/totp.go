@@ -0,0 +1,180 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key is an RFC 6238 TOTP configuration.
+type Key struct {
+	Secret    []byte
+	Digits    int
+	Period    time.Duration
+	Algorithm string
+
+	mu       sync.Mutex
+	lastStep int64
+}
+
+// Parse accepts a base32 seed, as shown under "enter this key manually" by
+// most enrollment pages, or a full otpauth://totp/ URI. Seeds get the usual
+// defaults of six digits, a 30 second period and SHA1.
+func Parse(s string) (*Key, error) {
+	s = strings.TrimSpace(s)
+	k := &Key{Digits: 6, Period: 30 * time.Second, Algorithm: "SHA1"}
+	if !strings.HasPrefix(strings.ToLower(s), "otpauth://") {
+		secret, err := decodeSecret(s)
+		if err != nil {
+			return nil, err
+		}
+		k.Secret = secret
+		return k, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing otpauth URI: %w", err)
+	}
+	if !strings.EqualFold(u.Host, "totp") {
+		return nil, fmt.Errorf("unsupported OTP type %q; only totp is supported", u.Host)
+	}
+	q := u.Query()
+	if k.Secret, err = decodeSecret(q.Get("secret")); err != nil {
+		return nil, err
+	}
+	if v := q.Get("digits"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 6 || n > 10 {
+			return nil, fmt.Errorf("invalid digits %q", v)
+		}
+		k.Digits = n
+	}
+	if v := q.Get("period"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid period %q", v)
+		}
+		k.Period = time.Duration(n) * time.Second
+	}
+	if v := q.Get("algorithm"); v != "" {
+		k.Algorithm = strings.ToUpper(v)
+		if newHash(k.Algorithm) == nil {
+			return nil, fmt.Errorf("unsupported algorithm %q", v)
+		}
+	}
+	return k, nil
+}
+
+// decodeSecret decodes a base32 seed, tolerating spaces, lower case and
+// missing padding.
+func decodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	s = strings.TrimRight(s, "=")
+	if s == "" {
+		return nil, fmt.Errorf("empty TOTP secret")
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("TOTP secret is not valid base32: %w", err)
+	}
+	return secret, nil
+}
+
+func newHash(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+	return nil
+}
+
+// Code returns the code for the time step containing t.
+func (k *Key) Code(t time.Time) string {
+	return k.code(k.step(t))
+}
+
+// Next returns the current code, first waiting for the next time step if
+// Next already used this one. Servers commonly refuse a code twice, which
+// would otherwise fail a second login within the same period.
+func (k *Key) Next() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := time.Now()
+	if k.step(now) <= k.lastStep {
+		time.Sleep(k.wait(now))
+		now = time.Now()
+	}
+	k.lastStep = k.step(now)
+	return k.code(k.lastStep)
+}
+
+// Wait returns how long Next called at t would wait for a fresh code.
+func (k *Key) Wait(t time.Time) time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.wait(t)
+}
+
+func (k *Key) wait(t time.Time) time.Duration {
+	if k.step(t) > k.lastStep {
+		return 0
+	}
+	return time.Unix((k.lastStep+1)*int64(k.Period/time.Second), 0).Sub(t)
+}
+
+// LastStep returns the time step of the last code returned by Next.
+func (k *Key) LastStep() int64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.lastStep
+}
+
+// SetLastStep tells Next that codes up to step were already used, for
+// example by an earlier run.
+func (k *Key) SetLastStep(step int64) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.lastStep = max(k.lastStep, step)
+}
+
+func (k *Key) step(t time.Time) int64 {
+	return t.Unix() / int64(k.Period/time.Second)
+}
+
+func (k *Key) code(step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(newHash(k.Algorithm), k.Secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3.
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	mod := uint64(1)
+	for i := 0; i < k.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", k.Digits, uint64(bin)%mod)
+}
+
+// Remaining returns how long the code for t stays valid.
+func (k *Key) Remaining(t time.Time) time.Duration {
+	period := int64(k.Period / time.Second)
+	return time.Duration(period-t.Unix()%period) * time.Second
+}
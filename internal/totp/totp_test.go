@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// TestRFC6238 checks the test vectors of RFC 6238, appendix B.
+func TestRFC6238(t *testing.T) {
+	secrets := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	for _, tc := range []struct {
+		unix                 int64
+		sha1, sha256, sha512 string
+	}{
+		{59, "94287082", "46119246", "90693936"},
+		{1111111109, "07081804", "68084774", "25091201"},
+		{1111111111, "14050471", "67062674", "99943326"},
+		{1234567890, "89005924", "91819424", "93441116"},
+		{2000000000, "69279037", "90698825", "38618901"},
+		{20000000000, "65353130", "77737706", "47863826"},
+	} {
+		for algorithm, want := range map[string]string{"SHA1": tc.sha1, "SHA256": tc.sha256, "SHA512": tc.sha512} {
+			k := &Key{Secret: []byte(secrets[algorithm]), Digits: 8, Period: 30 * time.Second, Algorithm: algorithm}
+			if got := k.Code(time.Unix(tc.unix, 0)); got != want {
+				t.Errorf("%s at %d = %s, want %s", algorithm, tc.unix, got, want)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	seed := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for _, tc := range []struct {
+		in        string
+		digits    int
+		period    time.Duration
+		algorithm string
+	}{
+		{seed, 6, 30 * time.Second, "SHA1"},
+		{"gezd gnbv gy3t qojq gezd gnbv gy3t qojq", 6, 30 * time.Second, "SHA1"},
+		{"otpauth://totp/Example:alice?secret=" + seed + "&issuer=Example", 6, 30 * time.Second, "SHA1"},
+		{"otpauth://totp/x?secret=" + seed + "&digits=8&period=60&algorithm=sha256", 8, 60 * time.Second, "SHA256"},
+	} {
+		k, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.in, err)
+			continue
+		}
+		if string(k.Secret) != "12345678901234567890" || k.Digits != tc.digits || k.Period != tc.period || k.Algorithm != tc.algorithm {
+			t.Errorf("Parse(%q) = %q, %d digits, %s, %s", tc.in, k.Secret, k.Digits, k.Period, k.Algorithm)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"not base32!",
+		"otpauth://hotp/x?secret=" + seed,
+		"otpauth://totp/x?secret=" + seed + "&digits=4",
+		"otpauth://totp/x?secret=" + seed + "&period=0",
+		"otpauth://totp/x?secret=" + seed + "&algorithm=MD5",
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) succeeded", in)
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	k := &Key{Secret: []byte("12345678901234567890"), Digits: 6, Period: 30 * time.Second, Algorithm: "SHA1"}
+	now := time.Unix(1000*30+10, 0)
+	if w := k.Wait(now); w != 0 {
+		t.Errorf("Wait before any code = %s, want 0", w)
+	}
+	k.SetLastStep(1000)
+	if w := k.Wait(now); w != 20*time.Second {
+		t.Errorf("Wait after using the current step = %s, want 20s", w)
+	}
+	k.SetLastStep(999)
+	if k.LastStep() != 1000 {
+		t.Errorf("SetLastStep went back to %d", k.LastStep())
+	}
+	if r := k.Remaining(now); r != 20*time.Second {
+		t.Errorf("Remaining = %s, want 20s", r)
+	}
+}
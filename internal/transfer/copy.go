@@ -0,0 +1,190 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Options controls how Copy behaves.
+type Options struct {
+	Recursive bool      // descend into directories
+	Preserve  bool      // keep permission bits and modification times
+	Progress  io.Writer // where to draw progress bars; nil disables them
+	Verify    bool      // compare SHA-256 of each copy against the bytes sent
+}
+
+// Stats summarizes a finished copy.
+type Stats struct {
+	Files    int
+	Bytes    int64
+	Verified int
+	Elapsed  time.Duration
+}
+
+// Copy copies srcs from one filesystem to dst on another, following scp
+// semantics: if dst is an existing directory each source lands inside it,
+// otherwise dst names the single copy.
+func Copy(srcFS FS, srcs []string, dstFS FS, dst string, opts Options) (Stats, error) {
+	c := &copier{src: srcFS, dst: dstFS, opts: opts}
+	start := time.Now()
+
+	dstIsDir := false
+	if info, err := dstFS.Stat(dst); err == nil && info.IsDir() {
+		dstIsDir = true
+	}
+	if len(srcs) > 1 && !dstIsDir {
+		return c.stats, fmt.Errorf("target %s is not a directory", dst)
+	}
+
+	for _, src := range srcs {
+		target := dst
+		if dstIsDir {
+			target = dstFS.Join(dst, srcFS.Base(src))
+		}
+		if err := c.copyEntry(src, target); err != nil {
+			c.stats.Elapsed = time.Since(start)
+			return c.stats, err
+		}
+	}
+	c.stats.Elapsed = time.Since(start)
+	return c.stats, nil
+}
+
+type copier struct {
+	src, dst FS
+	opts     Options
+	stats    Stats
+}
+
+func (c *copier) copyEntry(src, dst string) error {
+	info, err := c.src.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return c.copyDir(src, dst, info)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: not a regular file", src)
+	}
+	return c.copyFile(src, dst, info)
+}
+
+func (c *copier) copyDir(src, dst string, info fs.FileInfo) error {
+	if !c.opts.Recursive {
+		return fmt.Errorf("%s: is a directory (use -r)", src)
+	}
+	if err := c.dst.Mkdir(dst); err != nil {
+		return fmt.Errorf("creating %s: %w", dst, err)
+	}
+	entries, err := c.src.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := c.copyEntry(c.src.Join(src, e.Name()), c.dst.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return c.preserve(dst, info)
+}
+
+func (c *copier) copyFile(src, dst string, info fs.FileInfo) error {
+	in, err := c.src.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := c.dst.Create(dst)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", dst, err)
+	}
+
+	var r io.Reader = in
+	h := sha256.New()
+	if c.opts.Verify {
+		r = io.TeeReader(in, h)
+	}
+
+	bar := newProgress(c.opts.Progress, c.src.Base(src), info.Size())
+	n, err := copyData(out, r, info.Size(), bar)
+	bar.done()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("copying %s: %w", src, err)
+	}
+
+	c.stats.Files++
+	c.stats.Bytes += n
+	if c.opts.Verify {
+		if err := c.verify(dst, h.Sum(nil)); err != nil {
+			return err
+		}
+		c.stats.Verified++
+	}
+	return c.preserve(dst, info)
+}
+
+// verify checks that dst hashes to the digest of the bytes that were sent.
+func (c *copier) verify(dst string, want []byte) error {
+	var got []byte
+	var err error
+	if s, ok := c.dst.(Summer); ok {
+		got, err = s.SHA256(dst)
+	} else {
+		got, err = readSHA256(c.dst, dst)
+	}
+	if err != nil {
+		return fmt.Errorf("checksumming %s: %w", dst, err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("checksum mismatch on %s: sent %x, found %x", dst, want, got)
+	}
+	return nil
+}
+
+func (c *copier) preserve(dst string, info fs.FileInfo) error {
+	if !c.opts.Preserve {
+		return nil
+	}
+	if err := c.dst.Chmod(dst, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("setting mode on %s: %w", dst, err)
+	}
+	if err := c.dst.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("setting times on %s: %w", dst, err)
+	}
+	return nil
+}
+
+// copyData streams src into dst, reporting progress. Going through the
+// destination's ReaderFrom lets an SFTP upload pipeline its writes, since
+// the counting reader advertises the total size.
+func copyData(dst io.Writer, src io.Reader, size int64, bar *progress) (int64, error) {
+	r := &countingReader{r: src, size: size, bar: bar}
+	if rf, ok := dst.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(dst, r)
+}
+
+type countingReader struct {
+	r    io.Reader
+	size int64
+	bar  *progress
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.bar.add(int64(n))
+	return n, err
+}
+
+// Size lets sftp.File.ReadFrom use concurrent writes.
+func (r *countingReader) Size() int64 { return r.size }
@@ -0,0 +1,171 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"tele/internal/remote"
+)
+
+// FS is the subset of filesystem operations a copy needs. It is implemented
+// for the local disk and for a remote host over SFTP.
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.FileInfo, error)
+	Open(name string) (io.ReadCloser, error)
+	Create(name string) (io.WriteCloser, error)
+	Mkdir(name string) error
+	Chmod(name string, mode fs.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Glob(pattern string) ([]string, error)
+	Join(elem ...string) string
+	Base(name string) string
+}
+
+// Summer is implemented by filesystems that can checksum a file where it
+// lives instead of reading it back.
+type Summer interface {
+	SHA256(name string) ([]byte, error)
+}
+
+// HasMeta reports whether a path contains glob metacharacters.
+func HasMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// Expand expands glob patterns against fsys, leaving plain paths untouched.
+// A pattern that matches nothing is an error, as in scp.
+func Expand(fsys FS, patterns []string) ([]string, error) {
+	var out []string
+	for _, p := range patterns {
+		if !HasMeta(p) {
+			out = append(out, p)
+			continue
+		}
+		matches, err := fsys.Glob(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, &fs.PathError{Op: "glob", Path: p, Err: fs.ErrNotExist}
+		}
+		out = append(out, matches...)
+	}
+	return out, nil
+}
+
+// LocalFS is the local filesystem.
+type LocalFS struct{}
+
+func (LocalFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (LocalFS) ReadDir(name string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (LocalFS) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+
+func (LocalFS) Create(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+}
+
+func (LocalFS) Mkdir(name string) error {
+	err := os.Mkdir(name, 0755)
+	if os.IsExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (LocalFS) Chmod(name string, mode fs.FileMode) error { return os.Chmod(name, mode) }
+
+func (LocalFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (LocalFS) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+func (LocalFS) Join(elem ...string) string            { return filepath.Join(elem...) }
+func (LocalFS) Base(name string) string               { return filepath.Base(name) }
+
+// RemoteFS is a remote filesystem reached over SFTP.
+type RemoteFS struct {
+	Client *sftp.Client
+	// Conn, if set, is used to checksum files with sha256sum on the host.
+	Conn *ssh.Client
+}
+
+func (r RemoteFS) Stat(name string) (fs.FileInfo, error)      { return r.Client.Stat(name) }
+func (r RemoteFS) ReadDir(name string) ([]fs.FileInfo, error) { return r.Client.ReadDir(name) }
+func (r RemoteFS) Open(name string) (io.ReadCloser, error)    { return r.Client.Open(name) }
+func (r RemoteFS) Create(name string) (io.WriteCloser, error) { return r.Client.Create(name) }
+
+func (r RemoteFS) Mkdir(name string) error {
+	if info, err := r.Client.Stat(name); err == nil && info.IsDir() {
+		return nil
+	}
+	return r.Client.Mkdir(name)
+}
+
+func (r RemoteFS) Chmod(name string, mode fs.FileMode) error { return r.Client.Chmod(name, mode) }
+
+func (r RemoteFS) Chtimes(name string, atime, mtime time.Time) error {
+	return r.Client.Chtimes(name, atime, mtime)
+}
+
+func (r RemoteFS) Glob(pattern string) ([]string, error) { return r.Client.Glob(pattern) }
+func (r RemoteFS) Join(elem ...string) string            { return path.Join(elem...) }
+func (r RemoteFS) Base(name string) string               { return path.Base(name) }
+
+// SHA256 hashes a remote file with sha256sum when a shell connection is
+// available, falling back to reading it back over SFTP.
+func (r RemoteFS) SHA256(name string) ([]byte, error) {
+	if r.Conn != nil {
+		var out bytes.Buffer
+		code, err := remote.Run(r.Conn, "sha256sum -- "+remote.Quote(name), nil, &out, io.Discard)
+		if err == nil && code == 0 {
+			if field, _, ok := strings.Cut(out.String(), " "); ok {
+				if sum, err := hex.DecodeString(field); err == nil && len(sum) == sha256.Size {
+					return sum, nil
+				}
+			}
+		}
+	}
+	return readSHA256(r, name)
+}
+
+// readSHA256 hashes a file by streaming it from fsys.
+func readSHA256(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
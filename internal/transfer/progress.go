@@ -0,0 +1,84 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const barWidth = 24
+
+// progress draws a single-line progress bar for one file.
+// A nil *progress is valid and draws nothing.
+type progress struct {
+	w     io.Writer
+	label string
+	total int64
+	n     int64
+	start time.Time
+	last  time.Time
+}
+
+func newProgress(w io.Writer, label string, total int64) *progress {
+	if w == nil {
+		return nil
+	}
+	return &progress{w: w, label: label, total: total, start: time.Now()}
+}
+
+func (p *progress) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.n += n
+	if time.Since(p.last) >= 100*time.Millisecond {
+		p.draw()
+	}
+}
+
+func (p *progress) done() {
+	if p == nil {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.w)
+}
+
+func (p *progress) draw() {
+	p.last = time.Now()
+	frac := 1.0
+	if p.total > 0 {
+		frac = min(float64(p.n)/float64(p.total), 1)
+	}
+	filled := int(frac * barWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+	label := p.label
+	if len(label) > 24 {
+		label = label[:21] + "..."
+	}
+	fmt.Fprintf(p.w, "\r%-24s [%s] %3.0f%% %9s %11s", label, bar, frac*100,
+		FormatBytes(p.n), Rate(p.n, time.Since(p.start)))
+}
+
+// FormatBytes renders a byte count with a binary unit suffix.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Rate renders a throughput for n bytes moved in d.
+func Rate(n int64, d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return FormatBytes(int64(float64(n)/d.Seconds())) + "/s"
+}
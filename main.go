@@ -17,17 +17,59 @@ func main() {
 	case "init":
 		cmd.RunInit()
 	case "add":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Usage: tele add <name>")
-			os.Exit(1)
-		}
-		cmd.RunAdd(os.Args[2])
+		cmd.RunAdd(os.Args[2:])
 	case "go":
+		cmd.RunGo(os.Args[2:])
+	case "exec":
+		cmd.RunExec(os.Args[2:])
+	case "cp":
+		cmd.RunCp(os.Args[2:])
+	case "put":
+		cmd.RunPut(os.Args[2:])
+	case "get":
+		cmd.RunGet(os.Args[2:])
+	case "recordings":
+		cmd.RunRecordings(os.Args[2:])
+	case "edit":
+		cmd.RunEdit(os.Args[2:])
+	case "gen":
+		cmd.RunGen(os.Args[2:])
+	case "totp":
 		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Usage: tele go <name>")
+			fmt.Fprintln(os.Stderr, "Usage: tele totp <name>")
 			os.Exit(1)
 		}
-		cmd.RunGo(os.Args[2])
+		cmd.RunTOTP(os.Args[2])
+	case "hooks":
+		cmd.RunHooks()
+	case "mux":
+		cmd.RunMux(os.Args[2:])
+	case "ca":
+		cmd.RunCA(os.Args[2:])
+	case "import":
+		cmd.RunImport(os.Args[2:])
+	case "export":
+		cmd.RunExport(os.Args[2:])
+	case "backup":
+		cmd.RunBackup(os.Args[2:])
+	case "restore":
+		cmd.RunRestore(os.Args[2:])
+	case "sync":
+		cmd.RunSync(os.Args[2:])
+	case "recover":
+		cmd.RunRecover()
+	case "recovery":
+		cmd.RunRecovery(os.Args[2:])
+	case "team":
+		cmd.RunTeam(os.Args[2:])
+	case "audit":
+		cmd.RunAudit(os.Args[2:])
+	case "doctor":
+		cmd.RunDoctor(os.Args[2:])
+	case "check":
+		cmd.RunCheck(os.Args[2:])
+	case "rotate":
+		cmd.RunRotate(os.Args[2:])
 	case "list":
 		cmd.RunList()
 	case "rm":
@@ -47,9 +89,36 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, `Usage: tele <command> [args]
 
 Commands:
-  init         Set up master password
-  add <name>   Add a new SSH destination
-  go <name>    SSH into a destination
-  list         List all saved destinations
-  rm <name>    Remove a destination`)
+  init              Set up master password
+  add <name>        Add a new SSH destination
+  edit <name>       Change a destination's settings
+  go <name>         SSH into a destination (--record, --reconnect)
+  exec -- <cmd>     Run a command on many destinations in parallel
+  cp <src> <dst>    Copy files to, from or between destinations (name:path)
+  put <name> ...    Upload files to a destination
+  get <name> ...    Download files from a destination
+  recordings        List or play recorded sessions
+  rotate <name>     Change a destination's password on the host and in the vault
+  gen               Generate a random password or passphrase
+  totp <name>       Print a destination's current TOTP code
+  hooks             Set global pre-connect and post-disconnect hooks
+  mux               Share one connection per destination between commands
+  ca                Manage the SSH certificate authority
+  import <source>   Import destinations from ssh_config, password managers
+                    or other SSH clients
+  export ssh-config Write destinations to an ssh_config include file
+  backup <file>     Write an encrypted backup of the vault
+  restore <file>    Restore a backup (--mode merge|overwrite)
+  sync              Sync destinations with a git remote (init <remote>)
+  recover           Set a new master password with the recovery code
+  recovery          Split the vault key into recovery shares (split), reset
+                    the master password with them (combine), or replace the
+                    recovery code (code)
+  team              Share destinations with a team, each member unlocking
+                    with their own identity
+  check [name...]   Test reachability and credentials of destinations
+  audit             Show the log of credential use and changes (verify checks it)
+  doctor            Verify the vault and tele's setup (--fix repairs what is safe)
+  list              List all saved destinations
+  rm <name>         Remove a destination`)
 }